@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"rag_server/config"
+	"rag_server/models"
+	"sync/atomic"
+	"time"
+)
+
+// Cache stores values under string keys with a time to live
+type Cache interface {
+	// Get returns the value of the key and whether it was found
+	Get(key string) ([]byte, bool, error)
+
+	// Set stores the value, a zero ttl keeping it until evicted
+	Set(key string, value []byte, ttl time.Duration) error
+
+	// GetMany returns the values of the keys in one round-trip, nil for the missing ones
+	GetMany(keys []string) ([][]byte, error)
+
+	// SetMany stores the values in one round-trip with the same ttl
+	SetMany(values map[string][]byte, ttl time.Duration) error
+
+	// Append atomically adds values to the end of the list at key and resets its ttl
+	Append(key string, values [][]byte, ttl time.Duration) error
+
+	// List returns the values of the list at key, empty when it does not exist
+	List(key string) ([][]byte, error)
+
+	Delete(key string) error
+
+	// DeleteByPrefix removes every key starting with prefix and returns how many were removed
+	DeleteByPrefix(prefix string) (int, error)
+
+	// Keys lists up to limit keys starting with prefix
+	Keys(prefix string, limit int) ([]string, error)
+
+	// TTL returns the time left before the key expires, zero when it never does
+	TTL(key string) (time.Duration, error)
+
+	Stats() models.CacheStats
+
+	Close() error
+}
+
+// New creates an in-memory cache when the URL is "memory", or else connects to the Redis server.
+// An unreachable server is only reported: the client reconnects once it is back.
+func New(cfg config.RedisConfig) (Cache, error) {
+	if cfg.URL == "memory" {
+		return NewMemoryCache(cfg.MemoryEntries), nil
+	}
+
+	redisCache, err := NewRedisCache(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to configure Redis: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := redisCache.client.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis is not reachable yet: %v", err)
+	}
+
+	return redisCache, nil
+}
+
+// counters tracks the hits and misses of a cache
+type counters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *counters) record(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+func (c *counters) stats(backend string, keys int64) models.CacheStats {
+	stats := models.CacheStats{
+		Backend: backend,
+		Keys:    keys,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,222 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"rag_server/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryCache is a least recently used cache local to the process, for development and tests
+type MemoryCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+	counters
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+
+	// items holds the values of list entries, which have no value
+	items [][]byte
+	list  bool
+}
+
+// NewMemoryCache creates an in-memory cache evicting the least recently used entries beyond maxEntries
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.get(key)
+	return value, ok, nil
+}
+
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(&memoryEntry{key: key, value: value}, ttl)
+	return nil
+}
+
+func (c *MemoryCache) GetMany(keys []string) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i], _ = c.get(key)
+	}
+	return values, nil
+}
+
+func (c *MemoryCache) SetMany(values map[string][]byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, value := range values {
+		c.set(&memoryEntry{key: key, value: value}, ttl)
+	}
+	return nil
+}
+
+func (c *MemoryCache) Append(key string, values [][]byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var items [][]byte
+	if element, ok := c.entries[key]; ok {
+		if entry := element.Value.(*memoryEntry); entry.list && !entry.expired() {
+			items = entry.items
+		}
+	}
+
+	items = append(items[:len(items):len(items)], values...)
+	c.set(&memoryEntry{key: key, items: items, list: true}, ttl)
+	return nil
+}
+
+func (c *MemoryCache) List(key string) ([][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if entry.expired() {
+		c.remove(element)
+		return nil, nil
+	}
+	if !entry.list {
+		return nil, fmt.Errorf("Cache entry %s is not a list", key)
+	}
+
+	c.order.MoveToFront(element)
+	return entry.items, nil
+}
+
+// get returns the value of a key that is not a list, c.mu must be held
+func (c *MemoryCache) get(key string) ([]byte, bool) {
+	element, ok := c.entries[key]
+	if ok && element.Value.(*memoryEntry).expired() {
+		c.remove(element)
+		ok = false
+	}
+	ok = ok && !element.Value.(*memoryEntry).list
+	c.record(ok)
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).value, true
+}
+
+// set stores an entry and evicts the least recently used ones beyond the limit, c.mu must be held
+func (c *MemoryCache) set(entry *memoryEntry, ttl time.Duration) {
+	if ttl > 0 {
+		entry.expiresAt = time.Now().Add(ttl)
+	}
+
+	if element, ok := c.entries[entry.key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	return nil
+}
+
+func (c *MemoryCache) DeleteByPrefix(prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(element)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (c *MemoryCache) Keys(prefix string, limit int) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) && !element.Value.(*memoryEntry).expired() {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
+func (c *MemoryCache) TTL(key string) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok || element.Value.(*memoryEntry).expiresAt.IsZero() {
+		return 0, nil
+	}
+	return max(time.Until(element.Value.(*memoryEntry).expiresAt), 0), nil
+}
+
+func (c *MemoryCache) Stats() models.CacheStats {
+	c.mu.Lock()
+	keys := int64(len(c.entries))
+	c.mu.Unlock()
+
+	return c.stats("memory", keys)
+}
+
+func (c *MemoryCache) Close() error {
+	return nil
+}
+
+func (c *MemoryCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*memoryEntry).key)
+}
+
+func (e *memoryEntry) expired() bool {
+	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+}
@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheEviction(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		run        func(c *MemoryCache)
+		want       []string
+	}{
+		{
+			name:       "least recently set is evicted",
+			maxEntries: 2,
+			run: func(c *MemoryCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("b", []byte("2"), 0)
+				c.Set("c", []byte("3"), 0)
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name:       "get refreshes the entry",
+			maxEntries: 2,
+			run: func(c *MemoryCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("b", []byte("2"), 0)
+				c.Get("a")
+				c.Set("c", []byte("3"), 0)
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name:       "overwrite refreshes the entry",
+			maxEntries: 2,
+			run: func(c *MemoryCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("b", []byte("2"), 0)
+				c.Set("a", []byte("4"), 0)
+				c.Set("c", []byte("3"), 0)
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name:       "list read refreshes the entry",
+			maxEntries: 2,
+			run: func(c *MemoryCache) {
+				c.Append("a", [][]byte{[]byte("1")}, 0)
+				c.Set("b", []byte("2"), 0)
+				c.List("a")
+				c.Set("c", []byte("3"), 0)
+			},
+			want: []string{"a", "c"},
+		},
+		{
+			name:       "zero limit keeps every entry",
+			maxEntries: 0,
+			run: func(c *MemoryCache) {
+				c.Set("a", []byte("1"), 0)
+				c.Set("b", []byte("2"), 0)
+				c.Set("c", []byte("3"), 0)
+			},
+			want: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(tt.maxEntries)
+			tt.run(c)
+
+			got, _ := c.Keys("", 0)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		found bool
+	}{
+		{"expired entry", time.Millisecond, false},
+		{"live entry", time.Hour, true},
+		{"entry without ttl", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(10)
+			c.Set("key", []byte("value"), tt.ttl)
+			c.Append("list", [][]byte{[]byte("item")}, tt.ttl)
+			time.Sleep(5 * time.Millisecond)
+
+			if _, found, _ := c.Get("key"); found != tt.found {
+				t.Errorf("Get() found = %v, want %v", found, tt.found)
+			}
+			if items, _ := c.List("list"); (len(items) > 0) != tt.found {
+				t.Errorf("List() = %q, want found %v", items, tt.found)
+			}
+			if keys, _ := c.Keys("", 0); (len(keys) > 0) != tt.found {
+				t.Errorf("Keys() = %v, want found %v", keys, tt.found)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheList(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(c *MemoryCache) error
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "appends keep their order",
+			run: func(c *MemoryCache) error {
+				c.Append("list", [][]byte{[]byte("a"), []byte("b")}, 0)
+				return c.Append("list", [][]byte{[]byte("c")}, 0)
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name: "missing list is empty",
+			run:  func(c *MemoryCache) error { return nil },
+		},
+		{
+			name: "expired list starts over",
+			run: func(c *MemoryCache) error {
+				c.Append("list", [][]byte{[]byte("a")}, time.Millisecond)
+				time.Sleep(5 * time.Millisecond)
+				return c.Append("list", [][]byte{[]byte("b")}, 0)
+			},
+			want: []string{"b"},
+		},
+		{
+			name: "value replaced by a list",
+			run: func(c *MemoryCache) error {
+				c.Set("list", []byte("value"), 0)
+				return c.Append("list", [][]byte{[]byte("a")}, 0)
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "value is not a list",
+			run: func(c *MemoryCache) error {
+				return c.Set("list", []byte("value"), 0)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(10)
+			if err := tt.run(c); err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			items, err := c.List("list")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("List() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, item := range items {
+				got = append(got, string(item))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("List() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCacheDeleteByPrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		deleted int
+		want    []string
+	}{
+		{"matching prefix", "Search:", 2, []string{"Answer:a", "Embedding:a"}},
+		{"no match", "Crawl:", 0, []string{"Answer:a", "Embedding:a", "Search:a", "Search:b"}},
+		{"empty prefix deletes everything", "", 4, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMemoryCache(10)
+			c.Set("Search:a", []byte("1"), 0)
+			c.Set("Search:b", []byte("2"), 0)
+			c.Set("Embedding:a", []byte("3"), 0)
+			c.Append("Answer:a", [][]byte{[]byte("4")}, 0)
+
+			deleted, err := c.DeleteByPrefix(tt.prefix)
+			if err != nil {
+				t.Fatalf("DeleteByPrefix() error = %v", err)
+			}
+			if deleted != tt.deleted {
+				t.Errorf("DeleteByPrefix() = %d, want %d", deleted, tt.deleted)
+			}
+
+			got, _ := c.Keys("", 0)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Keys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,23 +2,192 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"github.com/redis/go-redis/v9"
-	"os"
+	"rag_server/models"
+	"sort"
+	"strings"
+	"time"
 )
 
-func InitCache() (*redis.Client, context.Context) {
-	url := os.Getenv("REDIS_URL")
-	if url == "" {
-		url = "redis://redis:6379/0"
-	}
+// globChars are the characters with a meaning in Redis MATCH patterns
+var globChars = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// RedisCache stores values in a Redis server shared by every instance of the server
+type RedisCache struct {
+	client *redis.Client
+	ctx    context.Context
+	counters
+}
 
+// NewRedisCache creates a cache on the Redis server at url
+func NewRedisCache(url string) (*RedisCache, error) {
 	opts, err := redis.ParseURL(url)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	return &RedisCache{
+		client: redis.NewClient(opts),
+		ctx:    context.Background(),
+	}, nil
+}
+
+func (c *RedisCache) Get(key string) ([]byte, bool, error) {
+	value, err := c.client.Get(c.ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		c.record(false)
+		return nil, false, nil
+	}
+	if err != nil {
+		c.record(false)
+		return nil, false, err
+	}
+
+	c.record(true)
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	return c.client.Set(c.ctx, key, value, ttl).Err()
+}
+
+func (c *RedisCache) GetMany(keys []string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	if len(keys) == 0 {
+		return values, nil
 	}
 
-	rdb := redis.NewClient(opts)
-	var ctx = context.Background()
+	results, err := c.client.MGet(c.ctx, keys...).Result()
+	if err != nil {
+		for range keys {
+			c.record(false)
+		}
+		return values, err
+	}
+
+	for i, result := range results {
+		data, ok := result.(string)
+		c.record(ok)
+		if ok {
+			values[i] = []byte(data)
+		}
+	}
+	return values, nil
+}
+
+func (c *RedisCache) SetMany(values map[string][]byte, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	pipe := c.client.Pipeline()
+	for key, value := range values {
+		pipe.Set(c.ctx, key, value, ttl)
+	}
+	_, err := pipe.Exec(c.ctx)
+	return err
+}
+
+func (c *RedisCache) Append(key string, values [][]byte, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	items := make([]interface{}, len(values))
+	for i, value := range values {
+		items[i] = value
+	}
+
+	pipe := c.client.TxPipeline()
+	pipe.RPush(c.ctx, key, items...)
+	if ttl > 0 {
+		pipe.Expire(c.ctx, key, ttl)
+	}
+	_, err := pipe.Exec(c.ctx)
+	return err
+}
+
+func (c *RedisCache) List(key string) ([][]byte, error) {
+	items, err := c.client.LRange(c.ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(items))
+	for i, item := range items {
+		values[i] = []byte(item)
+	}
+	return values, nil
+}
+
+func (c *RedisCache) Delete(key string) error {
+	return c.client.Del(c.ctx, key).Err()
+}
+
+func (c *RedisCache) DeleteByPrefix(prefix string) (int, error) {
+	deleted := 0
+	iter := c.client.Scan(c.ctx, 0, globChars.Replace(prefix)+"*", 500).Iterator()
+
+	var batch []string
+	for iter.Next(c.ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == 500 {
+			n, err := c.client.Del(c.ctx, batch...).Result()
+			if err != nil {
+				return deleted, err
+			}
+			deleted += int(n)
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+
+	if len(batch) > 0 {
+		n, err := c.client.Del(c.ctx, batch...).Result()
+		if err != nil {
+			return deleted, err
+		}
+		deleted += int(n)
+	}
+
+	return deleted, nil
+}
+
+func (c *RedisCache) Keys(prefix string, limit int) ([]string, error) {
+	var keys []string
+	iter := c.client.Scan(c.ctx, 0, globChars.Replace(prefix)+"*", 500).Iterator()
+	for iter.Next(c.ctx) && (limit <= 0 || len(keys) < limit) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (c *RedisCache) TTL(key string) (time.Duration, error) {
+	ttl, err := c.client.TTL(c.ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// Redis answers -1 for keys without expiry and -2 for missing keys
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (c *RedisCache) Stats() models.CacheStats {
+	keys, _ := c.client.DBSize(c.ctx).Result()
+	return c.stats("redis", keys)
+}
 
-	return rdb, ctx
+func (c *RedisCache) Close() error {
+	return c.client.Close()
 }
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the configuration of the server, read from defaults, then an optional YAML
+// file, then environment variables and finally command line flags
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Postgres   PostgresConfig   `yaml:"postgres"`
+	Redis      RedisConfig      `yaml:"redis"`
+	OpenAI     OpenAIConfig     `yaml:"openai"`
+	Models     ModelsConfig     `yaml:"models"`
+	Prompts    PromptsConfig    `yaml:"prompts"`
+	Context    ContextConfig    `yaml:"context"`
+	Embeddings EmbeddingsConfig `yaml:"embeddings"`
+	Search     SearchConfig     `yaml:"search"`
+	Reranker   RerankerConfig   `yaml:"reranker"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Crawler    CrawlerConfig    `yaml:"crawler"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"`
+
+	// AdminToken protects the cache administration endpoints, disabled while it is empty
+	AdminToken string `yaml:"admin_token"`
+}
+
+type PostgresConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Database string `yaml:"database"`
+}
+
+type RedisConfig struct {
+	// URL is a redis:// URL, or "memory" to use an in-memory cache
+	URL string `yaml:"url"`
+
+	// MemoryEntries bounds the in-memory cache used when the URL is "memory"
+	MemoryEntries int `yaml:"memory_entries"`
+}
+
+type OpenAIConfig struct {
+	APIKey  string `yaml:"api_key"`
+	BaseURL string `yaml:"base_url"`
+}
+
+// ModelsConfig holds the defaults of requests that do not choose their models or prompt
+type ModelsConfig struct {
+	Chat      string `yaml:"chat"`
+	Embedding string `yaml:"embedding"`
+	PromptID  string `yaml:"prompt_id"`
+}
+
+type PromptsConfig struct {
+	// Dir holds <name>@<version>.tmpl prompt templates, added to the embedded ones
+	Dir string `yaml:"dir"`
+}
+
+// ContextConfig holds the token budget of the context given to the chat model
+type ContextConfig struct {
+	Tokens       int `yaml:"tokens"`
+	AnswerTokens int `yaml:"answer_tokens"`
+
+	// Overflow is "trim", "drop" or "summarize", see models.ContextOptions
+	Overflow string `yaml:"overflow"`
+}
+
+type EmbeddingsConfig struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	TokensPerMinute   int `yaml:"tokens_per_minute"`
+	MaxRetries        int `yaml:"max_retries"`
+}
+
+type SearchConfig struct {
+	Provider     string `yaml:"provider"`
+	GoogleAPIKey string `yaml:"google_api_key"`
+	CseID        string `yaml:"cse_id"`
+	SearxngURL   string `yaml:"searxng_url"`
+	BraveAPIKey  string `yaml:"brave_api_key"`
+	BingAPIKey   string `yaml:"bing_api_key"`
+}
+
+type RerankerConfig struct {
+	URL string `yaml:"url"`
+}
+
+// CacheConfig holds the lifetimes of the cached search results, embeddings and answers
+type CacheConfig struct {
+	SearchTTL     time.Duration `yaml:"search_ttl"`
+	EmbeddingsTTL time.Duration `yaml:"embeddings_ttl"`
+	AnswersTTL    time.Duration `yaml:"answers_ttl"`
+}
+
+type CrawlerConfig struct {
+	UserAgent string        `yaml:"user_agent"`
+	Timeout   time.Duration `yaml:"timeout"`
+	HostDelay time.Duration `yaml:"host_delay"`
+
+	// RefreshEnabled runs the scheduler re-crawling stale web documents
+	RefreshEnabled bool `yaml:"refresh_enabled"`
+}
+
+// contextOverflows are the accepted values of Context.Overflow
+var contextOverflows = map[string]bool{"trim": true, "drop": true, "summarize": true}
+
+// searchProviders are the accepted values of Search.Provider
+var searchProviders = map[string]bool{"google": true, "searxng": true, "brave": true, "bing": true, "duckduckgo": true}
+
+// Default returns the configuration used when nothing overrides it
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Port: 8080},
+		Postgres: PostgresConfig{Host: "postgres", Port: 5432},
+		Redis:    RedisConfig{URL: "redis://redis:6379/0", MemoryEntries: 10000},
+		OpenAI:   OpenAIConfig{BaseURL: "https://api.openai.com/v1"},
+		Models: ModelsConfig{
+			Chat:      "gpt-4o",
+			Embedding: "text-embedding-3-small",
+			PromptID:  "rag_answer@1",
+		},
+		Context: ContextConfig{
+			Tokens:       6000,
+			AnswerTokens: 1000,
+			Overflow:     "trim",
+		},
+		Embeddings: EmbeddingsConfig{
+			RequestsPerMinute: 3000,
+			TokensPerMinute:   1000000,
+			MaxRetries:        5,
+		},
+		Search: SearchConfig{Provider: "google"},
+		Cache: CacheConfig{
+			SearchTTL:     24 * time.Hour,
+			EmbeddingsTTL: 30 * 24 * time.Hour,
+			AnswersTTL:    7 * 24 * time.Hour,
+		},
+		Crawler: CrawlerConfig{
+			Timeout:        20 * time.Second,
+			HostDelay:      time.Second,
+			RefreshEnabled: true,
+		},
+	}
+}
+
+// Load reads the configuration from the command line arguments, the environment, an optional
+// .env file and the optional YAML file given by -config or CONFIG_FILE, then validates it
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("rag_server", flag.ContinueOnError)
+	configFile := flags.String("config", "", "path of a YAML configuration file")
+	envFile := flags.String("env-file", ".env", "path of an optional .env file")
+	port := flags.Int("port", 0, "port of the HTTP server")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	// The .env file only fills variables missing from the environment
+	if err := godotenv.Load(*envFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("Failed to load %s: %v", *envFile, err)
+	}
+
+	cfg := Default()
+
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %v", *configFile, err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %v", *configFile, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadEnv overrides the configuration with the environment variables that are set
+func (c *Config) loadEnv() error {
+	env := envReader{}
+
+	env.Int("PORT", &c.Server.Port)
+	env.String("ADMIN_TOKEN", &c.Server.AdminToken)
+
+	env.String("POSTGRES_HOST", &c.Postgres.Host)
+	env.Int("POSTGRES_PORT", &c.Postgres.Port)
+	env.String("POSTGRES_USER", &c.Postgres.User)
+	env.String("POSTGRES_PASSWORD", &c.Postgres.Password)
+	env.String("POSTGRES_DB", &c.Postgres.Database)
+
+	env.String("REDIS_URL", &c.Redis.URL)
+	env.Int("CACHE_MEMORY_ENTRIES", &c.Redis.MemoryEntries)
+
+	env.String("OPENAI_API_KEY", &c.OpenAI.APIKey)
+	env.String("OPENAI_BASE_URL", &c.OpenAI.BaseURL)
+
+	env.String("CHAT_MODEL", &c.Models.Chat)
+	env.String("EMBEDDING_MODEL", &c.Models.Embedding)
+	env.String("PROMPT_ID", &c.Models.PromptID)
+
+	env.String("PROMPTS_DIR", &c.Prompts.Dir)
+
+	env.Int("CONTEXT_TOKENS", &c.Context.Tokens)
+	env.Int("ANSWER_TOKENS", &c.Context.AnswerTokens)
+	env.String("CONTEXT_OVERFLOW", &c.Context.Overflow)
+
+	env.Int("EMBEDDING_REQUESTS_PER_MINUTE", &c.Embeddings.RequestsPerMinute)
+	env.Int("EMBEDDING_TOKENS_PER_MINUTE", &c.Embeddings.TokensPerMinute)
+	env.Int("EMBEDDING_MAX_RETRIES", &c.Embeddings.MaxRetries)
+
+	env.String("SEARCH_PROVIDER", &c.Search.Provider)
+	env.String("GOOGLE_API_KEY", &c.Search.GoogleAPIKey)
+	env.String("CSE_ID", &c.Search.CseID)
+	env.String("SEARXNG_URL", &c.Search.SearxngURL)
+	env.String("BRAVE_API_KEY", &c.Search.BraveAPIKey)
+	env.String("BING_API_KEY", &c.Search.BingAPIKey)
+
+	env.String("RERANKER_URL", &c.Reranker.URL)
+
+	env.Duration("CACHE_TTL_SEARCH", &c.Cache.SearchTTL)
+	env.Duration("CACHE_TTL_EMBEDDINGS", &c.Cache.EmbeddingsTTL)
+	env.Duration("CACHE_TTL_ANSWERS", &c.Cache.AnswersTTL)
+
+	env.String("CRAWLER_USER_AGENT", &c.Crawler.UserAgent)
+	env.Duration("CRAWLER_TIMEOUT", &c.Crawler.Timeout)
+	env.Duration("CRAWLER_HOST_DELAY", &c.Crawler.HostDelay)
+	env.Bool("CRAWLER_REFRESH_ENABLED", &c.Crawler.RefreshEnabled)
+
+	return errors.Join(env.errs...)
+}
+
+// Validate checks the configuration is usable
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Postgres.Host != "", "postgres host is required")
+	check(c.Postgres.Port > 0 && c.Postgres.Port < 65536, "postgres port must be between 1 and 65535, got %d", c.Postgres.Port)
+
+	if c.Redis.URL != "memory" {
+		parsed, err := url.Parse(c.Redis.URL)
+		check(err == nil && (parsed.Scheme == "redis" || parsed.Scheme == "rediss"), "redis url must be a redis:// URL or \"memory\", got %q", c.Redis.URL)
+	}
+	check(c.Redis.MemoryEntries > 0, "redis memory_entries must be positive")
+
+	parsed, err := url.Parse(c.OpenAI.BaseURL)
+	check(err == nil && parsed.Scheme != "" && parsed.Host != "", "openai base_url must be an absolute URL, got %q", c.OpenAI.BaseURL)
+
+	check(c.Models.Chat != "", "models chat is required")
+	check(c.Models.Embedding != "", "models embedding is required")
+	check(c.Models.PromptID != "", "models prompt_id is required")
+
+	check(c.Context.Tokens > 0, "context tokens must be positive")
+	check(c.Context.AnswerTokens > 0, "context answer_tokens must be positive")
+	check(contextOverflows[c.Context.Overflow], "context overflow must be one of trim, drop or summarize, got %q", c.Context.Overflow)
+
+	check(c.Embeddings.RequestsPerMinute > 0, "embeddings requests_per_minute must be positive")
+	check(c.Embeddings.TokensPerMinute > 0, "embeddings tokens_per_minute must be positive")
+	check(c.Embeddings.MaxRetries >= 0, "embeddings max_retries cannot be negative")
+
+	check(searchProviders[c.Search.Provider], "search provider must be one of google, searxng, brave, bing or duckduckgo, got %q", c.Search.Provider)
+
+	check(c.Cache.SearchTTL > 0, "cache search_ttl must be positive")
+	check(c.Cache.EmbeddingsTTL > 0, "cache embeddings_ttl must be positive")
+	check(c.Cache.AnswersTTL > 0, "cache answers_ttl must be positive")
+
+	check(c.Crawler.Timeout > 0, "crawler timeout must be positive")
+	check(c.Crawler.HostDelay >= 0, "crawler host_delay cannot be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Invalid configuration: %v", errors.Join(errs...))
+	}
+	return nil
+}
+
+// envReader parses environment variables into configuration fields, collecting errors
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) String(name string, target *string) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		*target = value
+	}
+}
+
+func (e *envReader) Int(name string, target *int) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got %q", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envReader) Bool(name string, target *bool) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s must be a boolean, got %q", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
+
+func (e *envReader) Duration(name string, target *time.Duration) {
+	if value, ok := os.LookupEnv(name); ok && value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as \"12h\", got %q", name, value))
+			return
+		}
+		*target = parsed
+	}
+}
@@ -3,24 +3,20 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
+	"rag_server/config"
 
 	_ "github.com/lib/pq"
 )
 
 // InitDB initializes the PostgreSQL database connection
-func InitDB() (*sql.DB, error) {
-	host := os.Getenv("POSTGRES_HOST")
-	if host == "" {
-		host = "postgres"
-	}
-
+func InitDB(cfg config.PostgresConfig) (*sql.DB, error) {
 	connStr := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s sslmode=disable",
-		host,
-		os.Getenv("POSTGRES_USER"),
-		os.Getenv("POSTGRES_PASSWORD"),
-		os.Getenv("POSTGRES_DB"),
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host,
+		cfg.Port,
+		cfg.User,
+		cfg.Password,
+		cfg.Database,
 	)
 	return sql.Open("postgres", connStr)
 }
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations create the tables owned by rag_server, they must stay idempotent
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS web_documents (
+		url              TEXT PRIMARY KEY,
+		title            TEXT NOT NULL DEFAULT '',
+		etag             TEXT NOT NULL DEFAULT '',
+		last_modified    TEXT NOT NULL DEFAULT '',
+		content_hash     TEXT NOT NULL,
+		embedding_model  TEXT NOT NULL,
+		refresh_interval INTERVAL NOT NULL,
+		fetched_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+		next_fetch_at    TIMESTAMPTZ NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS web_documents_next_fetch_at_idx ON web_documents (next_fetch_at);`,
+	`CREATE TABLE IF NOT EXISTS answer_cache (
+		id              BIGSERIAL PRIMARY KEY,
+		question        TEXT NOT NULL,
+		embedding       vector NOT NULL,
+		embedding_model TEXT NOT NULL,
+		model           TEXT NOT NULL,
+		prompt_hash     TEXT NOT NULL,
+		answer          TEXT NOT NULL,
+		sources         JSONB NOT NULL,
+		created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`,
+	`CREATE INDEX IF NOT EXISTS answer_cache_lookup_idx ON answer_cache (model, prompt_hash, embedding_model);`,
+	`CREATE INDEX IF NOT EXISTS answer_cache_sources_idx ON answer_cache USING GIN (sources jsonb_path_ops);`,
+	`CREATE TABLE IF NOT EXISTS prompts (
+		name       TEXT NOT NULL,
+		version    INTEGER NOT NULL,
+		template   TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (name, version)
+	);`,
+	`ALTER TABLE web_documents ADD COLUMN IF NOT EXISTS failures INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE answer_cache ADD COLUMN IF NOT EXISTS options_hash TEXT NOT NULL DEFAULT '';`,
+	`CREATE INDEX IF NOT EXISTS answer_cache_options_idx ON answer_cache (model, prompt_hash, embedding_model, options_hash);`,
+	`CREATE INDEX IF NOT EXISTS answer_cache_created_at_idx ON answer_cache (created_at);`,
+	// n8n creates n8n_vectors, so its full-text index is only added once the table exists. Queries in
+	// another language than the default french configuration do not use it.
+	`DO $$
+	BEGIN
+		IF to_regclass('n8n_vectors') IS NOT NULL THEN
+			CREATE INDEX IF NOT EXISTS n8n_vectors_text_search_idx ON n8n_vectors USING GIN (to_tsvector('french'::regconfig, text));
+		END IF;
+	END $$;`,
+}
+
+// Migrate creates or updates the tables used by the server
+func Migrate(db *sql.DB) error {
+	for _, migration := range migrations {
+		if _, err := db.Exec(migration); err != nil {
+			return fmt.Errorf("Failed to run migration: %v", err)
+		}
+	}
+	return nil
+}
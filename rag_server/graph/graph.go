@@ -130,11 +130,15 @@ func (g *Graph[S]) Stream(input S, config context.Context) ([]StateItem[S], erro
 		// and find the first target node matching
 		var target *Node[S]
 		for _, edge := range current.Edges {
-			target, err = g.getEdgeTarget(input, edge, current, config)
+			target, err = g.getEdgeTarget(currentState, edge, current, config)
 
 			if err != nil {
 				return g.StateList, fmt.Errorf("error in edge from %s: %v", current.Name, err)
 			}
+
+			if target != nil {
+				break
+			}
 		}
 
 		if target == nil {
@@ -149,7 +153,7 @@ func (g *Graph[S]) Stream(input S, config context.Context) ([]StateItem[S], erro
 	return g.StateList, fmt.Errorf("reached max step limit")
 }
 
-func (g *Graph[S]) getEdgeTarget(input S, edge *Edge[S], current *Node[S], config context.Context) (*Node[S], error) {
+func (g *Graph[S]) getEdgeTarget(state S, edge *Edge[S], current *Node[S], config context.Context) (*Node[S], error) {
 	if edge.Type == SIMPLE {
 
 		if edge.Target == nil {
@@ -164,7 +168,7 @@ func (g *Graph[S]) getEdgeTarget(input S, edge *Edge[S], current *Node[S], confi
 			return nil, fmt.Errorf("EdgeFn not found for conditional edge from %s", current.Name)
 		}
 
-		targetName, err := (*edge.Condition)(input, config)
+		targetName, err := (*edge.Condition)(state, config)
 		if err != nil {
 			return nil, fmt.Errorf("error in edge from %s: %v", current.Name, err)
 		}
@@ -2,6 +2,6 @@ package graph
 
 // Message is a struct that represents a message
 type Message struct {
-	Role    string
-	Content string
+	Role    string `json:"role"`
+	Content string `json:"content"`
 }
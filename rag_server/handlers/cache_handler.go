@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rag_server/cache"
+	"rag_server/config"
+	"rag_server/models"
+	"rag_server/services"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultCacheKeysLimit = 100
+
+// HandleCacheStats reports the hit and miss counters of the caches
+func HandleCacheStats(cfg *config.Config, clients *services.Clients, store cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeAdmin(cfg, w, r) {
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]models.CacheStats{
+			"cache":      store.Stats(),
+			"embeddings": clients.Embedder.CacheStats(),
+		})
+	}
+}
+
+// HandleCacheKeys lists the keys of a namespace or prefix on GET and invalidates them on DELETE.
+// Cached answers live in Postgres and can only be invalidated, by document_id or all at once with all=true.
+func HandleCacheKeys(cfg *config.Config, db *sql.DB, store cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeAdmin(cfg, w, r) {
+			return
+		}
+
+		query := r.URL.Query()
+		namespace := query.Get("namespace")
+
+		if namespace == "answers" {
+			if r.Method != http.MethodDelete {
+				http.Error(w, "Cached answers can only be invalidated", http.StatusMethodNotAllowed)
+				return
+			}
+
+			if documentID := query.Get("document_id"); documentID != "" {
+				if err := services.InvalidateAnswers(db, documentID); err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				writeJSON(w, http.StatusOK, map[string]string{"invalidated": documentID})
+				return
+			}
+
+			if query.Get("all") != "true" {
+				http.Error(w, "document_id or all=true is required to invalidate cached answers", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := services.ClearAnswers(db)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+			return
+		}
+
+		prefix, err := cachePrefix(namespace, query.Get("prefix"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			limit := defaultCacheKeysLimit
+			if value := query.Get("limit"); value != "" {
+				if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+					http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+					return
+				}
+			}
+
+			keys, err := store.Keys(prefix, limit)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if keys == nil {
+				keys = []string{}
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"prefix": prefix, "keys": keys})
+
+		case http.MethodDelete:
+			if prefix == "" {
+				http.Error(w, "namespace or prefix is required", http.StatusBadRequest)
+				return
+			}
+
+			deleted, err := store.DeleteByPrefix(prefix)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+
+		default:
+			http.Error(w, "Only GET and DELETE requests are allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleCacheEntry shows a cached entry on GET and invalidates it on DELETE
+func HandleCacheEntry(cfg *config.Config, store cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorizeAdmin(cfg, w, r) {
+			return
+		}
+
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			// Lists, such as session histories, are not readable as a single value
+			var value interface{}
+			size := 0
+			data, found, err := store.Get(key)
+			if err != nil || !found {
+				items, listErr := store.List(key)
+				if listErr != nil || len(items) == 0 {
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+					} else {
+						http.Error(w, "Cache entry not found", http.StatusNotFound)
+					}
+					return
+				}
+
+				values := make([]interface{}, len(items))
+				for i, item := range items {
+					values[i] = cacheValue(item)
+					size += len(item)
+				}
+				value = values
+			} else {
+				value, size = cacheValue(data), len(data)
+			}
+
+			ttl, err := store.TTL(key)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"key":         key,
+				"ttl_seconds": int(ttl.Seconds()),
+				"size":        size,
+				"value":       value,
+			})
+
+		case http.MethodDelete:
+			if err := store.Delete(key); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Only GET and DELETE requests are allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleCacheWarm caches the search results and embeddings of a list of queries
+func HandleCacheWarm(cfg *config.Config, clients *services.Clients, store cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorizeAdmin(cfg, w, r) {
+			return
+		}
+
+		var req models.CacheWarmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Queries) == 0 {
+			http.Error(w, "queries is required", http.StatusBadRequest)
+			return
+		}
+
+		// Apply defaults
+		if req.Embedding == "" {
+			req.Embedding = cfg.Models.Embedding
+		}
+
+		response, err := services.WarmCache(clients, store, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// authorizeAdmin requires the admin bearer token, and denies every request when none is configured
+func authorizeAdmin(cfg *config.Config, w http.ResponseWriter, r *http.Request) bool {
+	token := cfg.Server.AdminToken
+	if token == "" {
+		http.Error(w, "Cache administration is disabled, set an admin token to enable it", http.StatusForbidden)
+		return false
+	}
+
+	provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// cachePrefix resolves the key prefix of a namespace, narrowed by an optional prefix inside it
+func cachePrefix(namespace, prefix string) (string, error) {
+	if namespace == "" {
+		return prefix, nil
+	}
+
+	namespacePrefix, ok := services.CacheNamespaces[namespace]
+	if !ok {
+		return "", fmt.Errorf("Unknown cache namespace %q", namespace)
+	}
+	return namespacePrefix + prefix, nil
+}
+
+// cacheValue renders JSON values as is, text as a string and binary values by their size
+func cacheValue(data []byte) interface{} {
+	switch {
+	case json.Valid(data):
+		return json.RawMessage(data)
+	case utf8.Valid(data):
+		return string(data)
+	default:
+		return fmt.Sprintf("%d bytes of binary data", len(data))
+	}
+}
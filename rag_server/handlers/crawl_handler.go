@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"rag_server/cache"
+	"rag_server/config"
+	"rag_server/models"
+	"rag_server/services"
+	"time"
+)
+
+const maxCrawlPages = 1000
+
+// HandleCrawlRequest starts site crawls on POST and reports their progress on GET ?id=
+func HandleCrawlRequest(cfg *config.Config, clients *services.Clients, db *sql.DB, store cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id is required", http.StatusBadRequest)
+				return
+			}
+
+			job, err := services.GetCrawlJob(store, id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if job == nil {
+				http.Error(w, "Crawl job not found", http.StatusNotFound)
+				return
+			}
+
+			writeJSON(w, http.StatusOK, job)
+
+		case http.MethodPost:
+			var req models.CrawlRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+
+			// Apply defaults
+			if req.Embedding == "" {
+				req.Embedding = cfg.Models.Embedding
+			}
+
+			if len(req.URLs) == 0 && len(req.Sitemaps) == 0 {
+				http.Error(w, "urls or sitemaps is required", http.StatusBadRequest)
+				return
+			}
+			if req.MaxPages > maxCrawlPages {
+				http.Error(w, "max_pages cannot exceed 1000", http.StatusBadRequest)
+				return
+			}
+
+			if req.RefreshInterval != "" {
+				if interval, err := time.ParseDuration(req.RefreshInterval); err != nil || interval < time.Minute {
+					http.Error(w, "refresh_interval must be a duration of at least 1m, e.g. \"24h\"", http.StatusBadRequest)
+					return
+				}
+			}
+
+			job, err := services.StartCrawlJob(clients, db, store, req)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, http.StatusAccepted, job)
+
+		default:
+			http.Error(w, "Only GET and POST requests are allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
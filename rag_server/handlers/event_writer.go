@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rag_server/models"
+	"strings"
+	"sync"
+)
+
+// eventWriter serialises stream events from concurrent goroutines as SSE or NDJSON
+type eventWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	format  string
+}
+
+// streamFormat returns the requested stream format, falling back to the Accept header
+func streamFormat(r *http.Request, requested string) string {
+	if requested != "" {
+		return requested
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "text/event-stream") {
+		return "sse"
+	}
+	if strings.Contains(accept, "application/x-ndjson") {
+		return "ndjson"
+	}
+
+	return ""
+}
+
+func newEventWriter(w http.ResponseWriter, format string) (*eventWriter, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming is not supported by the connection")
+	}
+
+	switch format {
+	case "sse":
+		w.Header().Set("Content-Type", "text/event-stream")
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	default:
+		return nil, fmt.Errorf("stream must be either \"sse\" or \"ndjson\"")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return &eventWriter{w: w, flusher: flusher, format: format}, nil
+}
+
+// Write sends a single event to the client and flushes it immediately
+func (ew *eventWriter) Write(event models.StreamEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+
+	if ew.format == "sse" {
+		fmt.Fprintf(ew.w, "event: %s\ndata: %s\n\n", event.Type, data)
+	} else {
+		fmt.Fprintf(ew.w, "%s\n", data)
+	}
+	ew.flusher.Flush()
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"rag_server/config"
+	"rag_server/models"
+	"rag_server/services"
+)
+
+const maxUploadSize = 32 << 20
+
+// HandleIngestRequest loads the files of a multipart upload and stores their chunks in the vector store
+func HandleIngestRequest(cfg *config.Config, clients *services.Clients, db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+			return
+		}
+
+		files := r.MultipartForm.File["files"]
+		if len(files) == 0 {
+			http.Error(w, "files is required", http.StatusBadRequest)
+			return
+		}
+
+		// Document IDs are optional, given once per file in upload order
+		documentIDs := r.MultipartForm.Value["document_id"]
+		if len(documentIDs) > 0 && len(documentIDs) != len(files) {
+			http.Error(w, "document_id must be given once per file", http.StatusBadRequest)
+			return
+		}
+
+		// Apply defaults
+		embedding := r.FormValue("embedding")
+		if embedding == "" {
+			embedding = cfg.Models.Embedding
+		}
+
+		results := make([]models.IngestResult, len(files))
+		for i, file := range files {
+			documentID := ""
+			if len(documentIDs) > 0 {
+				documentID = documentIDs[i]
+			}
+			results[i] = ingestFile(clients.Embedder, db, file, documentID, embedding)
+		}
+
+		writeJSON(w, http.StatusOK, results)
+	}
+}
+
+// ingestFile loads an uploaded file with the loader of its MIME type, replacing the chunks previously
+// stored under the document ID. Without an ID given by the client, the ID is derived from the file name
+// and content, so that only an identical upload replaces it.
+func ingestFile(embedder *services.Embedder, db *sql.DB, file *multipart.FileHeader, documentID, embedding string) models.IngestResult {
+	result := models.IngestResult{
+		File:       file.Filename,
+		MimeType:   services.DetectMimeType(file.Header.Get("Content-Type"), file.Filename),
+		DocumentID: documentID,
+	}
+
+	loader, err := services.LoaderFor(result.MimeType)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	content, err := file.Open()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if result.DocumentID == "" {
+		hash := sha256.Sum256(data)
+		result.DocumentID = "upload:" + file.Filename + ":" + hex.EncodeToString(hash[:8])
+	}
+
+	chunks, err := loader.Load(data, file.Filename)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Chunks, err = services.IngestChunks(embedder, db, chunks, map[string]interface{}{
+		"document_id": result.DocumentID,
+		"file_name":   file.Filename,
+		"mime_type":   result.MimeType,
+		"source":      "upload",
+	}, embedding)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
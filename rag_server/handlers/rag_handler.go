@@ -3,14 +3,19 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
+	"rag_server/cache"
+	"rag_server/config"
+	"rag_server/graph"
 	"rag_server/models"
+	"rag_server/prompts"
 	"rag_server/services"
 	"sync"
 )
 
 // HandleRAGRequest handles the RAG API requests
-func HandleRAGRequest(db *sql.DB) http.HandlerFunc {
+func HandleRAGRequest(cfg *config.Config, clients *services.Clients, db *sql.DB, store cache.Cache, registry *prompts.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
@@ -23,34 +28,195 @@ func HandleRAGRequest(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// Only conversation turns may come from the client, system instructions belong to the prompt
+		for _, message := range req.History {
+			if message.Role != "user" && message.Role != "assistant" {
+				http.Error(w, "history roles must be either \"user\" or \"assistant\"", http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Apply defaults
 		if req.Embedding == "" {
-			req.Embedding = "text-embedding-3-small"
+			req.Embedding = cfg.Models.Embedding
 		}
 		if req.Model == "" {
-			req.Model = "gpt-4o"
+			req.Model = cfg.Models.Chat
+		}
+		if req.PromptID == "" {
+			req.PromptID = cfg.Models.PromptID
+		}
+
+		prompt, err := registry.Resolve(req.PromptID, req.Prompt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Template = prompt
+
+		if req.ContextTokens <= 0 {
+			req.ContextTokens = cfg.Context.Tokens
+		}
+		if req.AnswerTokens <= 0 {
+			req.AnswerTokens = cfg.Context.AnswerTokens
+		}
+		if req.ContextOverflow == "" {
+			req.ContextOverflow = cfg.Context.Overflow
+		}
+
+		if req.TopK <= 0 {
+			req.TopK = 10
+		}
+		if (req.Reranker != "" || req.MMR) && req.Candidates <= 0 {
+			req.Candidates = 3 * req.TopK
 		}
-		if req.Prompt == "" {
-			req.Prompt = `
-				You are a RAG model answering questions based on provided documents.
-				1. Use only the documents for answers, without personal opinions or extra context. 
-				2. End responses with source filenames and URLs: "[ filename ]( url )".
-				3. If insufficient information is found, say: "The provided documents do not contain enough information to answer the question."
-			`
+
+		if (req.Reranker != "" || req.MMR) && req.Candidates < req.TopK {
+			http.Error(w, "candidates cannot be lower than top_k", http.StatusBadRequest)
+			return
+		}
+
+		if req.SearchMode != "" && req.SearchMode != "vector" && req.SearchMode != "hybrid" {
+			http.Error(w, "search_mode must be either \"vector\" or \"hybrid\"", http.StatusBadRequest)
+			return
+		}
+		if req.Fusion != "" && req.Fusion != "rrf" && req.Fusion != "weighted" {
+			http.Error(w, "fusion must be either \"rrf\" or \"weighted\"", http.StatusBadRequest)
+			return
+		}
+
+		switch req.QueryStrategy {
+		case "", "rewrite", "multi_query", "hyde":
+		default:
+			http.Error(w, "query_strategy must be one of \"rewrite\", \"multi_query\" or \"hyde\"", http.StatusBadRequest)
+			return
+		}
+
+		switch req.ContextOverflow {
+		case "trim", "drop", "summarize":
+		default:
+			http.Error(w, "context_overflow must be one of \"trim\", \"drop\" or \"summarize\"", http.StatusBadRequest)
+			return
+		}
+
+		if req.VectorWeight < 0 || req.TextWeight < 0 {
+			http.Error(w, "vector_weight and text_weight cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		if req.MMRLambda != nil && (*req.MMRLambda < 0 || *req.MMRLambda > 1) {
+			http.Error(w, "mmr_lambda must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		if req.CacheThreshold != nil && (*req.CacheThreshold <= 0 || *req.CacheThreshold > 1) {
+			http.Error(w, "cache_threshold must be greater than 0 and at most 1", http.StatusBadRequest)
+			return
+		}
+
+		// The fallback crawls its results concurrently like the search answers
+		if req.WebResults < 0 || req.WebResults > maxCrawlLimit {
+			http.Error(w, "web_results must be between 0 and 10", http.StatusBadRequest)
+			return
+		}
+
+		if req.Reranker != "" {
+			if _, err := clients.Reranker(req.Reranker, req.Model); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Load the stored conversation before any streamed byte is written
+		history := req.History
+		if req.SessionID != "" {
+			stored, err := services.LoadHistory(store, req.SessionID)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if len(stored) > 0 {
+				history = stored
+			}
+		}
+
+		var events *eventWriter
+		if format := streamFormat(r, req.Stream); format != "" {
+			var err error
+			if events, err = newEventWriter(w, format); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// answer processes one question, streaming its events tagged with the question index when requested
+		answer := func(i int, question string, history []graph.Message) models.RagResponseItem {
+			if events == nil {
+				return services.ProcessQuestion(clients, db, store, question, history, req)
+			}
+
+			response := services.StreamQuestion(r.Context(), clients, db, store, question, history, req, func(event models.StreamEvent) {
+				event.Index = i
+				events.Write(event)
+			})
+			if response.Error != "" {
+				events.Write(models.StreamEvent{
+					Type:     "error",
+					Index:    i,
+					Question: question,
+					Content:  response.Error,
+				})
+				return response
+			}
+			events.Write(models.StreamEvent{
+				Type:     "answer",
+				Index:    i,
+				Question: question,
+				Content:  response.Answer,
+				Sources:  response.Sources,
+			})
+			return response
 		}
 
-		var wg sync.WaitGroup
 		responses := make([]models.RagResponseItem, len(req.Questions))
 
-		for i, question := range req.Questions {
-			wg.Add(1)
-			go func(i int, question string) {
-				defer wg.Done()
-				responses[i] = services.ProcessQuestion(db, question, req.Prompt, req.Embedding, req.Model)
-			}(i, question)
+		if req.SessionID != "" || len(history) > 0 {
+			// Conversation turns depend on each other and are answered in order
+			for i, question := range req.Questions {
+				responses[i] = answer(i, question, history)
+
+				// A failed question is not part of the conversation
+				if responses[i].Error != "" {
+					continue
+				}
+				history = append(history,
+					graph.Message{Role: "user", Content: question},
+					graph.Message{Role: "assistant", Content: responses[i].Answer},
+				)
+
+				if req.SessionID != "" {
+					if err := services.SaveTurn(store, req.SessionID, question, responses[i].Answer); err != nil {
+						log.Printf("Failed to save turn of session %s: %v", req.SessionID, err)
+					}
+				}
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i, question := range req.Questions {
+				wg.Add(1)
+				go func(i int, question string) {
+					defer wg.Done()
+					responses[i] = answer(i, question, nil)
+				}(i, question)
+			}
+			wg.Wait()
 		}
 
-		wg.Wait()
+		// A stream closes with a summary of all responses
+		if events != nil {
+			events.Write(models.StreamEvent{Type: "summary", Responses: responses})
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(responses); err != nil {
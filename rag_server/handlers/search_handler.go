@@ -1,17 +1,27 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
-	"github.com/redis/go-redis/v9"
 	"net/http"
+	"rag_server/cache"
+	"rag_server/config"
 	"rag_server/models"
+	"rag_server/prompts"
 	"rag_server/services"
+	"regexp"
 	"sync"
 )
 
+var dateRestrictPattern = regexp.MustCompile(`^[dwmy][0-9]*$`)
+
+const (
+	// maxCrawlLimit bounds the result pages crawled concurrently for each question
+	maxCrawlLimit = 10
+	maxPassages   = 50
+)
+
 // HandleSearchRequest handles the Web Search API requests
-func HandleSearchRequest(rdb *redis.Client, ctx context.Context) http.HandlerFunc {
+func HandleSearchRequest(cfg *config.Config, clients *services.Clients, store cache.Cache, registry *prompts.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
@@ -26,15 +36,67 @@ func HandleSearchRequest(rdb *redis.Client, ctx context.Context) http.HandlerFun
 
 		// Apply defaults
 		if req.Model == "" {
-			req.Model = "gpt-4o"
+			req.Model = cfg.Models.Chat
+		}
+		if req.PromptID == "" {
+			req.PromptID = cfg.Models.PromptID
+		}
+
+		prompt, err := registry.Resolve(req.PromptID, req.Prompt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Template = prompt
+
+		if req.ContextTokens <= 0 {
+			req.ContextTokens = cfg.Context.Tokens
+		}
+		if req.AnswerTokens <= 0 {
+			req.AnswerTokens = cfg.Context.AnswerTokens
+		}
+		if req.ContextOverflow == "" {
+			req.ContextOverflow = cfg.Context.Overflow
+		}
+
+		switch req.ContextOverflow {
+		case "trim", "drop", "summarize":
+		default:
+			http.Error(w, "context_overflow must be one of \"trim\", \"drop\" or \"summarize\"", http.StatusBadRequest)
+			return
 		}
-		if req.Prompt == "" {
-			req.Prompt = `
-				You are a RAG model answering questions based on provided documents.
-				1. Use only the documents for answers, without personal opinions or extra context. 
-				2. End responses with source filenames and URLs: "[ filename ]( url )".
-				3. If insufficient information is found, say: "The provided documents do not contain enough information to answer the question."
-			`
+
+		if req.SafeSearch != "" && req.SafeSearch != "active" && req.SafeSearch != "off" {
+			http.Error(w, "safe_search must be either \"active\" or \"off\"", http.StatusBadRequest)
+			return
+		}
+		if req.DateRestrict != "" && !dateRestrictPattern.MatchString(req.DateRestrict) {
+			http.Error(w, "date_restrict must look like d7, w2, m6 or y1", http.StatusBadRequest)
+			return
+		}
+
+		if req.Threshold != nil && (*req.Threshold < 0 || *req.Threshold > 1) {
+			http.Error(w, "threshold must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+
+		if req.CrawlLimit < 0 || req.CrawlLimit > maxCrawlLimit {
+			http.Error(w, "crawl_limit must be between 0 and 10", http.StatusBadRequest)
+			return
+		}
+		if req.Passages < 0 || req.Passages > maxPassages {
+			http.Error(w, "passages must be between 0 and 50", http.StatusBadRequest)
+			return
+		}
+
+		provider, err := clients.SearchProvider(req.Provider)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := services.ValidateDateRestrict(provider.Name(), req.SearchOptions); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		var wg sync.WaitGroup
@@ -44,7 +106,7 @@ func HandleSearchRequest(rdb *redis.Client, ctx context.Context) http.HandlerFun
 			wg.Add(1)
 			go func(i int, question string) {
 				defer wg.Done()
-				responses[i] = services.ProcessSearch(rdb, ctx, question)
+				responses[i] = services.ProcessSearch(clients, store, provider, question, req)
 			}(i, question)
 		}
 
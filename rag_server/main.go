@@ -1,35 +1,79 @@
 package main
 
 import (
-	"github.com/joho/godotenv"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"rag_server/cache"
+	"rag_server/config"
 	"rag_server/db"
 	"rag_server/handlers"
+	"rag_server/prompts"
+	"rag_server/services"
 )
 
 func main() {
-	// Load env file
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+	// Load the configuration from flags, environment, .env and YAML file
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	// Initialize database connection
-	dbConn, err := db.InitDB()
+	dbConn, err := db.InitDB(cfg.Postgres)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer dbConn.Close()
 
-	// Initialize Redis cache
-	rdb, ctx := cache.InitCache()
-	defer rdb.Close()
+	if err := db.Migrate(dbConn); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// Initialize the cache, in memory when the Redis URL is "memory"
+	store, err := cache.New(cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to initialize cache: %v", err)
+	}
+	defer store.Close()
+
+	// Build the API clients shared by all requests, reusing embeddings of texts already seen
+	clients := services.NewClients(cfg, store)
+
+	// Load the answer prompts: built-in templates, then the prompts directory and table
+	registry, err := prompts.NewRegistry()
+	if err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	if cfg.Prompts.Dir != "" {
+		if err := registry.LoadFiles(os.DirFS(cfg.Prompts.Dir), "."); err != nil {
+			log.Fatalf("Failed to load prompts: %v", err)
+		}
+	}
+	if err := registry.LoadDatabase(dbConn); err != nil {
+		log.Fatalf("Failed to load prompts: %v", err)
+	}
+	if _, err := registry.Get(cfg.Models.PromptID); err != nil {
+		log.Fatalf("Invalid default prompt: %v", err)
+	}
+
+	// Re-crawl stale web documents in the background
+	if cfg.Crawler.RefreshEnabled {
+		services.StartRefreshScheduler(clients, dbConn)
+	}
 
 	// Set up HTTP handlers
-	http.HandleFunc("/api/rag", handlers.HandleRAGRequest(dbConn))
-	http.HandleFunc("/api/search", handlers.HandleSearchRequest(rdb, ctx))
+	http.HandleFunc("/api/rag", handlers.HandleRAGRequest(cfg, clients, dbConn, store, registry))
+	http.HandleFunc("/api/search", handlers.HandleSearchRequest(cfg, clients, store, registry))
+	http.HandleFunc("/api/crawl", handlers.HandleCrawlRequest(cfg, clients, dbConn, store))
+	http.HandleFunc("/api/ingest", handlers.HandleIngestRequest(cfg, clients, dbConn))
+	http.HandleFunc("/api/cache/stats", handlers.HandleCacheStats(cfg, clients, store))
+	http.HandleFunc("/api/cache/keys", handlers.HandleCacheKeys(cfg, dbConn, store))
+	http.HandleFunc("/api/cache/entry", handlers.HandleCacheEntry(cfg, store))
+	http.HandleFunc("/api/cache/warm", handlers.HandleCacheWarm(cfg, clients, store))
 
-	log.Println("Server running on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	log.Printf("Server running on port %d", cfg.Server.Port)
+	log.Fatal(http.ListenAndServe(addr, nil))
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// CacheHit identifies the cached answer of a similar question
+type CacheHit struct {
+	ID         int64     `json:"id"`
+	Question   string    `json:"question"`
+	Similarity float64   `json:"similarity"`
+	CreatedAt  time.Time `json:"created_at"`
+}
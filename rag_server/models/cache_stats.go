@@ -0,0 +1,10 @@
+package models
+
+// CacheStats counts the lookups of a cache since the server started
+type CacheStats struct {
+	Backend string  `json:"backend,omitempty"`
+	Keys    int64   `json:"keys,omitempty"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
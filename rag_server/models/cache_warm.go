@@ -0,0 +1,16 @@
+package models
+
+// CacheWarmRequest lists queries whose search results and embeddings are cached ahead of time
+type CacheWarmRequest struct {
+	Queries   []string `json:"queries"`
+	Provider  string   `json:"provider"`
+	Embedding string   `json:"embedding"`
+	SearchOptions
+}
+
+// CacheWarmResponse counts the entries warmed
+type CacheWarmResponse struct {
+	Queries    int `json:"queries"`
+	Search     int `json:"search"`
+	Embeddings int `json:"embeddings"`
+}
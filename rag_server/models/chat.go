@@ -1,11 +1,32 @@
 package models
 
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
 type OpenAIChatRequest struct {
-	Model    string `json:"model"`
-	Messages []struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	} `json:"messages"`
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	Temperature    *float64        `json:"temperature,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+
+	// MaxCompletionTokens caps the answer, max_tokens being deprecated and rejected by reasoning models
+	MaxCompletionTokens int `json:"max_completion_tokens,omitempty"`
+}
+
+// ResponseFormat constrains the chat model output, e.g. {"type": "json_object"}
+type ResponseFormat struct {
+	Type       string      `json:"type"`
+	JSONSchema *JSONSchema `json:"json_schema,omitempty"`
+}
+
+// JSONSchema is the schema of a "json_schema" structured output
+type JSONSchema struct {
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
 }
 
 type OpenAIChatResponse struct {
@@ -13,5 +34,18 @@ type OpenAIChatResponse struct {
 		Message struct {
 			Content string `json:"content"`
 		} `json:"message"`
+
+		// FinishReason is "length" when the answer was cut by the token limit
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// OpenAIChatStreamChunk is a single server-sent chunk of a streamed chat completion
+type OpenAIChatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
 }
@@ -3,6 +3,14 @@ package models
 import "encoding/json"
 
 type ContextItem struct {
+	ID       string          `json:"id"`
 	Text     string          `json:"text"`
 	Metadata json.RawMessage `json:"metadata"`
+	Score    float64         `json:"score"`
+
+	// Origin is "vector" for the document store or "web" for crawled pages
+	Origin string `json:"origin"`
+
+	// Embedding is only loaded when a stage such as MMR needs it
+	Embedding []float64 `json:"-"`
 }
@@ -0,0 +1,24 @@
+package models
+
+// ContextUsage reports how the context items were fitted into the token budget
+type ContextUsage struct {
+	// Window is the context window of the chat model
+	Window int `json:"window"`
+
+	// PromptTokens counts the rendered prompt and history without context items
+	PromptTokens int `json:"prompt_tokens"`
+
+	// AnswerTokens is the room reserved for the answer
+	AnswerTokens int `json:"answer_tokens"`
+
+	// Budget is the number of tokens available to the context items
+	Budget int `json:"budget"`
+
+	// ContextTokens is the number of tokens used by the context items
+	ContextTokens int `json:"context_tokens"`
+
+	// Dropped, Trimmed and Summarized list the IDs of the chunks that exceeded the budget
+	Dropped    []string `json:"dropped,omitempty"`
+	Trimmed    []string `json:"trimmed,omitempty"`
+	Summarized []string `json:"summarized,omitempty"`
+}
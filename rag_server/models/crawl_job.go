@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// CrawlRequest starts the crawl of a site into the vector store
+type CrawlRequest struct {
+	URLs      []string `json:"urls"`
+	Sitemaps  []string `json:"sitemaps"`
+	MaxDepth  int      `json:"max_depth"`
+	MaxPages  int      `json:"max_pages"`
+	Embedding string   `json:"embedding"`
+
+	// RefreshInterval is how often the crawled pages are re-fetched, e.g. "24h"
+	RefreshInterval string `json:"refresh_interval"`
+}
+
+// CrawlJob is the progress of a crawl, stored in Redis while it runs
+type CrawlJob struct {
+	ID      string       `json:"id"`
+	Status  string       `json:"status"` // "running", "completed" or "failed"
+	Request CrawlRequest `json:"request"`
+
+	Discovered int `json:"discovered"`
+	Crawled    int `json:"crawled"`
+	Ingested   int `json:"ingested"`
+	Chunks     int `json:"chunks"`
+	Unchanged  int `json:"unchanged"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+
+	Errors     []string   `json:"errors,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
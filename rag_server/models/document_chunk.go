@@ -0,0 +1,7 @@
+package models
+
+// DocumentChunk is a piece of a loaded document ready for embedding, with its position in the document
+type DocumentChunk struct {
+	Text     string                 `json:"text"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
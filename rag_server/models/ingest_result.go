@@ -0,0 +1,10 @@
+package models
+
+// IngestResult reports the ingestion of an uploaded file
+type IngestResult struct {
+	File       string `json:"file"`
+	MimeType   string `json:"mime_type"`
+	DocumentID string `json:"document_id"`
+	Chunks     int    `json:"chunks"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "rag_server/prompts"
+
+// PromptOptions selects the prompt template writing the answer
+type PromptOptions struct {
+	// PromptID names the prompt as "name" for its latest version or "name@version"
+	PromptID string `json:"prompt_id"`
+
+	// Prompt replaces the system message of the default prompt with free text
+	Prompt string `json:"prompt"`
+
+	// AnswerLanguage is the language of the answer, empty answers in the language of the question
+	AnswerLanguage string `json:"answer_language"`
+
+	// Template is the prompt resolved from PromptID or Prompt, set by the handler
+	Template *prompts.Prompt `json:"-"`
+}
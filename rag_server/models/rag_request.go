@@ -1,13 +1,145 @@
 package models
 
+import "rag_server/graph"
+
 type RagRequest struct {
 	Questions []string `json:"questions"`
-	Prompt    string   `json:"prompt"`
 	Embedding string   `json:"embedding"`
 	Model     string   `json:"model"`
+
+	// Stream is "sse" or "ndjson" to stream answers as they are generated
+	Stream string `json:"stream"`
+
+	// Debug adds a trace of the intermediate steps to every response
+	Debug bool `json:"debug"`
+
+	PromptOptions
+	ConversationOptions
+	QueryOptions
+	RetrievalOptions
+	RerankOptions
+	DiversityOptions
+	CorrectiveOptions
+	CacheOptions
+	ContextOptions
+}
+
+// ConversationOptions turns the questions into successive turns of a conversation
+type ConversationOptions struct {
+	// SessionID loads and stores the conversation history in Redis
+	SessionID string `json:"session_id"`
+
+	// History holds prior turns sent by the client, used when no session is stored
+	History []graph.Message `json:"history"`
+
+	// HistoryTokens is the token budget of the history passed to the chat model
+	HistoryTokens int `json:"history_tokens"`
+}
+
+// QueryOptions selects a pre-retrieval strategy applied to every question
+type QueryOptions struct {
+	// QueryStrategy is "rewrite", "multi_query" or "hyde", empty searches the question as is
+	QueryStrategy string `json:"query_strategy"`
+
+	// QueryVariants is the number of paraphrases searched by "multi_query"
+	QueryVariants int `json:"query_variants"`
+}
+
+// RetrievalOptions selects how SearchItems looks up context items
+type RetrievalOptions struct {
+	// SearchMode is either "vector" (default) or "hybrid"
+	SearchMode string `json:"search_mode"`
+
+	// Fusion is the hybrid merge strategy, either "rrf" (default) or "weighted"
+	Fusion string `json:"fusion"`
+
+	// VectorWeight and TextWeight balance both result lists during fusion
+	VectorWeight float64 `json:"vector_weight"`
+	TextWeight   float64 `json:"text_weight"`
+
+	// Language is the PostgreSQL text search configuration used by full-text queries
+	Language string `json:"language"`
+
+	// Limit is the number of items returned, set by ProcessQuestion
+	Limit int `json:"-"`
+
+	// WithEmbeddings also loads the embedding of every item, set by ProcessQuestion
+	WithEmbeddings bool `json:"-"`
+}
+
+// RerankOptions configures the reranking stage between retrieval and answer generation
+type RerankOptions struct {
+	// Reranker is "llm", "cross-encoder" or "lexical", empty disables reranking
+	Reranker string `json:"reranker"`
+
+	// Candidates is the number of items over-fetched for the reranker
+	Candidates int `json:"candidates"`
+
+	// TopK is the number of items kept for answer generation
+	TopK int `json:"top_k"`
+}
+
+// DiversityOptions enables Maximal Marginal Relevance over the retrieved candidates
+type DiversityOptions struct {
+	MMR bool `json:"mmr"`
+
+	// MMRLambda trades relevance (1) against diversity (0), defaults to 0.5
+	MMRLambda *float64 `json:"mmr_lambda"`
+}
+
+// CorrectiveOptions grades the retrieved context and falls back to web search when it is insufficient
+type CorrectiveOptions struct {
+	WebFallback bool `json:"web_fallback"`
+
+	// WebResults is the number of search results crawled by the fallback, at most 10
+	WebResults int `json:"web_results"`
+
+	// WebProvider is the search provider of the fallback, see SearchRequest.Provider
+	WebProvider string `json:"web_provider"`
+}
+
+// CacheOptions reuses the answers of near-identical questions
+type CacheOptions struct {
+	// SemanticCache looks up and stores answers by question similarity, outside conversations
+	SemanticCache bool `json:"semantic_cache"`
+
+	// CacheThreshold is the minimum cosine similarity of a cached question, defaults to 0.95
+	CacheThreshold *float64 `json:"cache_threshold"`
+}
+
+// ContextOptions bounds the size of the context given to the chat model
+type ContextOptions struct {
+	// ContextTokens is the token budget of the context items, lowered to fit the context window of the model
+	ContextTokens int `json:"context_tokens"`
+
+	// AnswerTokens is the room reserved for the answer, which also caps its length.
+	// Answers cut by this limit are reported as truncated.
+	AnswerTokens int `json:"answer_tokens"`
+
+	// ContextOverflow is "trim" (default) to cut the first item exceeding the budget,
+	// "drop" to skip the items exceeding it or "summarize" to condense them with the chat model
+	ContextOverflow string `json:"context_overflow"`
 }
 
 type RagResponseItem struct {
-	Question string `json:"question"`
-	Answer   string `json:"answer"`
+	Question string   `json:"question"`
+	Answer   string   `json:"answer"`
+	Sources  []Source `json:"sources"`
+
+	// StandaloneQuestion is the follow-up rewritten with the conversation, used for retrieval
+	StandaloneQuestion string `json:"standalone_question,omitempty"`
+
+	// Prompt is the ID of the prompt that wrote the answer, e.g. "rag_answer@2"
+	Prompt string `json:"prompt,omitempty"`
+
+	// Truncated reports that the answer was cut by the answer_tokens limit
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is set when the question failed, the answer then holds the same message
+	Error string `json:"error,omitempty"`
+
+	// Cache describes the cached answer returned in place of a new one
+	Cache *CacheHit `json:"cache,omitempty"`
+
+	Trace *Trace `json:"trace,omitempty"`
 }
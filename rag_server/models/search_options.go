@@ -0,0 +1,26 @@
+package models
+
+// SearchOptions narrow a web search, every provider maps them to its own parameters
+type SearchOptions struct {
+	// Num is the number of results to return, defaults to 10
+	Num int `json:"num"`
+
+	// Start is the 1-based index of the first result, Page is used when it is unset
+	Start int `json:"start"`
+	Page  int `json:"page"`
+
+	// Language restricts results to a language, e.g. "lang_fr" or "fr"
+	Language string `json:"lr"`
+
+	// Country boosts results from a country, e.g. "fr"
+	Country string `json:"gl"`
+
+	// DateRestrict keeps recent results only: "d[n]", "w[n]", "m[n]" or "y[n]"
+	DateRestrict string `json:"date_restrict"`
+
+	// SiteSearch restricts results to a site, e.g. "developer.mozilla.org"
+	SiteSearch string `json:"site_search"`
+
+	// SafeSearch is "active" or "off"
+	SafeSearch string `json:"safe_search"`
+}
@@ -2,11 +2,43 @@ package models
 
 type SearchRequest struct {
 	Questions []string `json:"questions"`
-	Prompt    string   `json:"prompt"`
 	Model     string   `json:"model"`
+
+	PromptOptions
+	ContextOptions
+
+	// Provider is "google", "searxng", "brave", "bing" or "duckduckgo",
+	// empty uses the search.provider configuration
+	Provider string `json:"provider"`
+
+	SearchOptions
+
+	// Filter drops the results the chat model scores below Threshold (0 to 1, defaults to 0.5)
+	Filter    bool     `json:"filter"`
+	Threshold *float64 `json:"threshold"`
+
+	// Answer crawls the top results and has the model write a cited answer from them
+	Answer bool `json:"answer"`
+
+	// CrawlLimit is the number of results crawled to write the answer, at most 10
+	CrawlLimit int `json:"crawl_limit"`
+
+	// Passages is the number of extracted passages given to the model, at most 50
+	Passages int `json:"passages"`
 }
 
 type SearchResponse struct {
-	Question string               `json:"question"`
-	Links    []GoogleSearchResult `json:"links"`
+	Question string         `json:"question"`
+	Links    []SearchResult `json:"links"`
+	Answer   string         `json:"answer,omitempty"`
+	Sources  []Source       `json:"sources,omitempty"`
+
+	// Prompt is the ID of the prompt that wrote the answer
+	Prompt string `json:"prompt,omitempty"`
+
+	// Truncated reports that the answer was cut by the answer_tokens limit
+	Truncated bool `json:"truncated,omitempty"`
+
+	// Error is set when a step of the search failed, such as filtering the results or writing the answer
+	Error string `json:"error,omitempty"`
 }
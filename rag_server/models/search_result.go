@@ -0,0 +1,14 @@
+package models
+
+// SearchResult is a web search result, normalised across search providers
+type SearchResult struct {
+	Title       string `json:"title"`
+	Snippet     string `json:"snippet"`
+	Description string `json:"description"`
+	Url         string `json:"url"`
+	Image       string `json:"image"`
+
+	// Relevance and Reason are set by the relevance filter, Relevance ranges from 0 to 1
+	Relevance *float64 `json:"relevance,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+}
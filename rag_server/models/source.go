@@ -0,0 +1,17 @@
+package models
+
+// Source is a context item used to answer a question, cited in the answer as [Index]
+type Source struct {
+	Index      int     `json:"index"`
+	DocumentID string  `json:"document_id"`
+	Title      string  `json:"title"`
+	URL        string  `json:"url"`
+	ChunkID    string  `json:"chunk_id"`
+	Chunk      string  `json:"chunk"`
+	Location   string  `json:"location,omitempty"`
+	Score      float64 `json:"score"`
+	Origin     string  `json:"origin"`
+
+	// Cited reports whether the answer references this source
+	Cited bool `json:"cited"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// StreamEvent is a single event of a streamed /api/rag response.
+// Type is one of "sources", "delta", "answer", "summary" or "error".
+// An "error" event replaces the "answer" event of a failed question, its content holding the error.
+type StreamEvent struct {
+	Type      string            `json:"type"`
+	Index     int               `json:"index"`
+	Question  string            `json:"question,omitempty"`
+	Content   string            `json:"content,omitempty"`
+	Sources   []Source          `json:"sources,omitempty"`
+	Responses []RagResponseItem `json:"responses,omitempty"`
+}
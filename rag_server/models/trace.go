@@ -0,0 +1,25 @@
+package models
+
+// Trace reports the intermediate steps of a question, returned when debug is enabled
+type Trace struct {
+	// Strategy is the pre-retrieval strategy applied to the question
+	Strategy string `json:"strategy,omitempty"`
+
+	// Queries are the texts searched in the vector store
+	Queries []string `json:"queries"`
+
+	// HypotheticalAnswer is the document embedded in place of the question by HyDE
+	HypotheticalAnswer string `json:"hypothetical_answer,omitempty"`
+
+	// Retrieved is the number of distinct items found before reranking
+	Retrieved int `json:"retrieved"`
+
+	// Relevant is the number of items the grader kept, when grading is enabled
+	Relevant *int `json:"relevant,omitempty"`
+
+	// Context reports the token budget of the context given to the chat model
+	Context *ContextUsage `json:"context,omitempty"`
+
+	// Path lists the graph nodes run to answer the question
+	Path []string `json:"path"`
+}
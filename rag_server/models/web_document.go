@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// WebDocument tracks the freshness of a crawled page stored in the vector store
+type WebDocument struct {
+	URL             string        `json:"url"`
+	Title           string        `json:"title"`
+	ETag            string        `json:"etag,omitempty"`
+	LastModified    string        `json:"last_modified,omitempty"`
+	ContentHash     string        `json:"content_hash"`
+	EmbeddingModel  string        `json:"embedding_model"`
+	RefreshInterval time.Duration `json:"refresh_interval"`
+	FetchedAt       time.Time     `json:"fetched_at"`
+	NextFetchAt     time.Time     `json:"next_fetch_at"`
+
+	// Failures counts the consecutive failed refreshes, delaying the next attempt
+	Failures int `json:"failures,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// WebPage is the main content of a crawled page with the metadata found in its markup
+type WebPage struct {
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url"`
+	Title        string `json:"title"`
+	Byline       string `json:"byline,omitempty"`
+	PublishedAt  string `json:"published_at,omitempty"`
+	SiteName     string `json:"site_name,omitempty"`
+	Markdown     string `json:"markdown"`
+}
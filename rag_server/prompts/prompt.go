@@ -0,0 +1,105 @@
+package prompts
+
+import (
+	"bytes"
+	"fmt"
+	"rag_server/graph"
+	"strings"
+	"text/template"
+)
+
+// Variables are the values available to prompt templates
+type Variables struct {
+	Question string
+	Context  []ContextItem
+	History  []graph.Message
+
+	// Language is the language the answer should be written in, empty to follow the question
+	Language string
+}
+
+// ContextItem is a numbered document passage the model can cite
+type ContextItem struct {
+	// ID is the ID of the chunk, not meant to be rendered
+	ID string
+
+	Index    int
+	Title    string
+	URL      string
+	Location string
+	Text     string
+	Metadata map[string]interface{}
+}
+
+// Prompt is a versioned template rendering the system and user messages of a chat request
+type Prompt struct {
+	Name    string
+	Version int
+
+	// Source is "file", "database" or "inline"
+	Source string
+
+	template *template.Template
+
+	// system replaces the system template of inline prompts, rendered as is
+	system string
+}
+
+// ID identifies the prompt as name@version, suffixed with +inline when its system message was replaced
+func (p *Prompt) ID() string {
+	id := fmt.Sprintf("%s@%d", p.Name, p.Version)
+	if p.Source == "inline" {
+		id += "+inline"
+	}
+	return id
+}
+
+// Fingerprint changes whenever the rendered messages may change, for caching
+func (p *Prompt) Fingerprint() string {
+	if p.Source == "inline" {
+		return p.ID() + ":" + p.system
+	}
+	return p.ID()
+}
+
+// Render returns the system and user messages of the prompt
+func (p *Prompt) Render(vars Variables) (string, string, error) {
+	system := p.system
+	if system == "" {
+		var err error
+		if system, err = p.execute("system", vars); err != nil {
+			return "", "", err
+		}
+	}
+
+	user, err := p.execute("user", vars)
+	if err != nil {
+		return "", "", err
+	}
+
+	return system, user, nil
+}
+
+func (p *Prompt) execute(name string, vars Variables) (string, error) {
+	var buf bytes.Buffer
+	if err := p.template.ExecuteTemplate(&buf, name, vars); err != nil {
+		return "", fmt.Errorf("Failed to render prompt %s: %v", p.ID(), err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// parse compiles a prompt template, which must define a "system" and a "user" template
+func parse(name string, version int, source, text string) (*Prompt, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse prompt %s@%d: %v", name, version, err)
+	}
+
+	for _, part := range []string{"system", "user"} {
+		if tmpl.Lookup(part) == nil {
+			return nil, fmt.Errorf("Prompt %s@%d does not define a %q template", name, version, part)
+		}
+	}
+
+	return &Prompt{Name: name, Version: version, Source: source, template: tmpl}, nil
+}
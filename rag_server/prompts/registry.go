@@ -0,0 +1,140 @@
+package prompts
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// fileName matches prompt files named <name>@<version>.tmpl
+var fileName = regexp.MustCompile(`^([a-z0-9_\-]+)@(\d+)\.tmpl$`)
+
+// Registry holds the prompts by name and version
+type Registry struct {
+	mu      sync.RWMutex
+	prompts map[string]map[int]*Prompt
+}
+
+// NewRegistry creates a registry holding the prompts embedded in the binary
+func NewRegistry() (*Registry, error) {
+	r := &Registry{prompts: make(map[string]map[int]*Prompt)}
+	if err := r.LoadFiles(templates, "templates"); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register adds a prompt, replacing the one with the same name and version
+func (r *Registry) Register(prompt *Prompt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.prompts[prompt.Name] == nil {
+		r.prompts[prompt.Name] = make(map[int]*Prompt)
+	}
+	r.prompts[prompt.Name][prompt.Version] = prompt
+}
+
+// LoadFiles registers the <name>@<version>.tmpl files of dir
+func (r *Registry) LoadFiles(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("Failed to read prompts in %s: %v", dir, err)
+	}
+
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		text, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("Failed to read prompt %s: %v", entry.Name(), err)
+		}
+
+		version, _ := strconv.Atoi(match[2])
+		prompt, err := parse(match[1], version, "file", string(text))
+		if err != nil {
+			return err
+		}
+		r.Register(prompt)
+	}
+
+	return nil
+}
+
+// LoadDatabase registers the prompts stored in the prompts table, overriding files of the same version
+func (r *Registry) LoadDatabase(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name, version, template FROM prompts;`)
+	if err != nil {
+		return fmt.Errorf("Failed to query prompts: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, text string
+		var version int
+		if err := rows.Scan(&name, &version, &text); err != nil {
+			return fmt.Errorf("Failed to scan prompt: %v", err)
+		}
+
+		prompt, err := parse(name, version, "database", text)
+		if err != nil {
+			return err
+		}
+		r.Register(prompt)
+	}
+
+	return rows.Err()
+}
+
+// Get returns the prompt identified by "name@version", or the latest version of "name"
+func (r *Registry) Get(id string) (*Prompt, error) {
+	name, versionText, pinned := strings.Cut(id, "@")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.prompts[name]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("Unknown prompt %q", name)
+	}
+
+	if pinned {
+		version, err := strconv.Atoi(versionText)
+		if err != nil || versions[version] == nil {
+			return nil, fmt.Errorf("Unknown version %q of prompt %q", versionText, name)
+		}
+		return versions[version], nil
+	}
+
+	latest := 0
+	for version := range versions {
+		latest = max(latest, version)
+	}
+	return versions[latest], nil
+}
+
+// Resolve returns the prompt identified by id, with its system message replaced by the
+// inline system prompt when one is given
+func (r *Registry) Resolve(id, system string) (*Prompt, error) {
+	base, err := r.Get(id)
+	if err != nil || system == "" {
+		return base, err
+	}
+
+	inline := *base
+	inline.Source = "inline"
+	inline.system = strings.TrimSpace(system)
+	return &inline, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rag_server/models"
+	"time"
+)
+
+const defaultCacheThreshold = 0.95
+
+// clearAnswersQuery deletes every cached answer, since any new document may change any answer
+const clearAnswersQuery = `DELETE FROM answer_cache;`
+
+// invalidateAnswersQuery deletes the cached answers citing the document $1
+const invalidateAnswersQuery = `
+	DELETE FROM answer_cache
+	WHERE sources @> jsonb_build_array(jsonb_build_object('document_id', $1::text));
+`
+
+// LookupAnswer returns the cached answer of the most similar question asked with the same model,
+// prompt and retrieval options in the last ttl, or nil when none is within the similarity threshold
+func LookupAnswer(db *sql.DB, embedding []float64, req models.RagRequest, ttl time.Duration) (*models.RagResponseItem, error) {
+	threshold := defaultCacheThreshold
+	if req.CacheThreshold != nil {
+		threshold = *req.CacheThreshold
+	}
+
+	var hit models.CacheHit
+	var answer string
+	var sources []byte
+	err := db.QueryRow(`
+		SELECT id, question, answer, sources, created_at, 1 - (embedding <=> $1) AS similarity
+		FROM answer_cache
+		WHERE model = $2 AND prompt_hash = $3 AND embedding_model = $4 AND options_hash = $5 AND created_at > $6
+		ORDER BY embedding <=> $1
+		LIMIT 1;
+	`, ToVectorString(embedding), req.Model, promptHash(req), req.Embedding, optionsHash(req), time.Now().Add(-ttl),
+	).Scan(&hit.ID, &hit.Question, &answer, &sources, &hit.CreatedAt, &hit.Similarity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query answer cache: %v", err)
+	}
+	if hit.Similarity < threshold {
+		return nil, nil
+	}
+
+	response := &models.RagResponseItem{Answer: answer, Cache: &hit}
+	if err := json.Unmarshal(sources, &response.Sources); err != nil {
+		return nil, fmt.Errorf("Failed to decode cached sources: %v", err)
+	}
+
+	return response, nil
+}
+
+// StoreAnswer caches the answer of a question under its embedding, model, prompt and
+// retrieval options, and purges the answers older than ttl
+func StoreAnswer(db *sql.DB, embedding []float64, req models.RagRequest, response models.RagResponseItem, ttl time.Duration) error {
+	sources, err := json.Marshal(response.Sources)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal sources: %v", err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO answer_cache (question, embedding, embedding_model, model, prompt_hash, options_hash, answer, sources)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+	`, response.Question, ToVectorString(embedding), req.Embedding, req.Model, promptHash(req), optionsHash(req), response.Answer, sources)
+	if err != nil {
+		return fmt.Errorf("Failed to store answer: %v", err)
+	}
+
+	if _, err := db.Exec(`DELETE FROM answer_cache WHERE created_at <= $1;`, time.Now().Add(-ttl)); err != nil {
+		return fmt.Errorf("Failed to purge expired answers: %v", err)
+	}
+
+	return nil
+}
+
+// InvalidateAnswers removes the cached answers citing a document, once it changed or disappeared
+func InvalidateAnswers(db *sql.DB, documentID string) error {
+	if _, err := db.Exec(invalidateAnswersQuery, documentID); err != nil {
+		return fmt.Errorf("Failed to invalidate cached answers: %v", err)
+	}
+	return nil
+}
+
+// promptHash identifies the prompt and answer language shaping the answers of a request
+func promptHash(req models.RagRequest) string {
+	hash := sha256.Sum256([]byte(req.Template.Fingerprint() + "\n" + req.AnswerLanguage))
+	return hex.EncodeToString(hash[:])
+}
+
+// optionsHash identifies the retrieval and context options shaping the answers of a request
+func optionsHash(req models.RagRequest) string {
+	data, _ := json.Marshal([]interface{}{
+		req.RetrievalOptions, req.QueryOptions, req.RerankOptions, req.DiversityOptions, req.CorrectiveOptions, req.ContextOptions,
+	})
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
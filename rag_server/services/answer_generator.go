@@ -1,66 +1,88 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"net/http"
-	"os"
+	"rag_server/graph"
 	"rag_server/models"
+	"rag_server/prompts"
 )
 
-// GenerateAnswer queries the OpenAI chat model to generate an answer for the question
-func GenerateAnswer(question string, context []string, prompt, model string) (string, error) {
-	openAIAPIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIAPIKey == "" {
-		return "", fmt.Errorf("OpenAI API key is not set")
+// GenerateAnswer renders the prompt and queries the OpenAI chat model to generate an answer
+// of at most maxTokens tokens, unbounded when zero. It reports whether the limit cut the answer.
+func GenerateAnswer(chat *ChatClient, prompt *prompts.Prompt, vars prompts.Variables, model string, maxTokens int) (string, bool, error) {
+	request, err := answerRequest(prompt, vars, model, maxTokens)
+	if err != nil {
+		return "", false, err
 	}
 
-	url := "https://api.openai.com/v1/chat/completions"
-	messages := []struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
-	}{
-		{Role: "system", Content: prompt},
-		{Role: "user", Content: fmt.Sprintf("Question: %s\nContext: %s", question, context)},
-	}
+	answer, finishReason, err := chat.chatCompletion(request)
+	return answer, finishReason == "length", err
+}
 
-	requestBody, err := json.Marshal(models.OpenAIChatRequest{
-		Model:    model,
-		Messages: messages,
-	})
+// GenerateAnswerStream is GenerateAnswer with token deltas forwarded to onDelta as they arrive,
+// until the stream ends or ctx is cancelled
+func GenerateAnswerStream(ctx context.Context, chat *ChatClient, prompt *prompts.Prompt, vars prompts.Variables, model string, maxTokens int, onDelta func(string)) (string, bool, error) {
+	request, err := answerRequest(prompt, vars, model, maxTokens)
 	if err != nil {
-		return "", fmt.Errorf("Failed to marshal chat request: %v", err)
+		return "", false, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return "", fmt.Errorf("Failed to create chat request: %v", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", openAIAPIKey))
+	answer, finishReason, err := chat.chatCompletionStream(ctx, request, onDelta)
+	return answer, finishReason == "length", err
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// answerRequest places the prior conversation turns between the system prompt and the question
+func answerRequest(prompt *prompts.Prompt, vars prompts.Variables, model string, maxTokens int) (models.OpenAIChatRequest, error) {
+	system, user, err := prompt.Render(vars)
 	if err != nil {
-		return "", fmt.Errorf("Failed to execute chat request: %v", err)
+		return models.OpenAIChatRequest{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body := new(bytes.Buffer)
-		body.ReadFrom(resp.Body)
-		return "", fmt.Errorf("Chat request failed: %s", body.String())
+	messages := []models.ChatMessage{{Role: "system", Content: system}}
+	for _, message := range vars.History {
+		messages = append(messages, models.ChatMessage{Role: message.Role, Content: message.Content})
 	}
+	messages = append(messages, models.ChatMessage{Role: "user", Content: user})
 
-	var chatResponse models.OpenAIChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
-		return "", fmt.Errorf("Failed to decode chat response: %v", err)
+	request := models.OpenAIChatRequest{
+		Model:    model,
+		Messages: messages,
 	}
+	limitCompletion(&request, maxTokens)
+
+	return request, nil
+}
 
-	if len(chatResponse.Choices) == 0 || chatResponse.Choices[0].Message.Content == "" {
-		return "", fmt.Errorf("No chat response returned")
+// promptContext turns numbered sources into the context items of prompt templates,
+// items holding the metadata of the sources in the same order
+func promptContext(sources []models.Source, items []models.ContextItem) []prompts.ContextItem {
+	context := make([]prompts.ContextItem, len(sources))
+	for i, source := range sources {
+		var metadata map[string]interface{}
+		if i < len(items) {
+			_ = json.Unmarshal(items[i].Metadata, &metadata)
+		}
+
+		context[i] = prompts.ContextItem{
+			ID:       source.ChunkID,
+			Index:    source.Index,
+			Title:    source.Title,
+			URL:      source.URL,
+			Location: source.Location,
+			Text:     source.Chunk,
+			Metadata: metadata,
+		}
 	}
+	return context
+}
 
-	return chatResponse.Choices[0].Message.Content, nil
+// answerVariables gathers the template variables of a question
+func answerVariables(question string, sources []models.Source, items []models.ContextItem, history []graph.Message, language string) prompts.Variables {
+	return prompts.Variables{
+		Question: question,
+		Context:  promptContext(sources, items),
+		History:  history,
+		Language: language,
+	}
 }
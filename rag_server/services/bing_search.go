@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"rag_server/models"
+	"strconv"
+)
+
+// BingProvider searches with the Bing Web Search API
+type BingProvider struct {
+	APIKey string
+}
+
+func (p *BingProvider) Name() string {
+	return "bing"
+}
+
+// bingCount is the largest page Bing serves
+const bingCount = 50
+
+// Search fetches as many pages as needed to gather the requested number of results
+func (p *BingProvider) Search(query string, opts models.SearchOptions) ([]models.SearchResult, error) {
+	if p.APIKey == "" {
+		return nil, fmt.Errorf("BING_API_KEY is not set")
+	}
+	if err := ValidateDateRestrict(p.Name(), opts); err != nil {
+		return nil, err
+	}
+
+	count := resultCount(opts, 100)
+	offset := resultOffset(opts)
+
+	params := url.Values{}
+	params.Set("q", withSite(query, opts))
+	if market := locale(opts); market != "" {
+		params.Set("mkt", market)
+	}
+	if unit, _ := datePeriod(opts); unit != 0 {
+		params.Set("freshness", map[byte]string{'d': "Day", 'w': "Week", 'm': "Month"}[unit])
+	}
+	switch opts.SafeSearch {
+	case "active":
+		params.Set("safeSearch", "Strict")
+	case "off":
+		params.Set("safeSearch", "Off")
+	}
+
+	var links []models.SearchResult
+	for len(links) < count {
+		num := min(count-len(links), bingCount)
+
+		page, err := p.searchPage(params, offset, num)
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, page...)
+		if len(page) < num {
+			break
+		}
+		offset += num
+	}
+
+	return links, nil
+}
+
+func (p *BingProvider) searchPage(params url.Values, offset, num int) ([]models.SearchResult, error) {
+	params.Set("count", strconv.Itoa(num))
+	params.Set("offset", strconv.Itoa(offset))
+
+	req, err := http.NewRequest("GET", "https://api.bing.microsoft.com/v7.0/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create search request: %v", err)
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", p.APIKey)
+
+	var result struct {
+		WebPages struct {
+			Value []struct {
+				Name    string `json:"name"`
+				URL     string `json:"url"`
+				Snippet string `json:"snippet"`
+			} `json:"value"`
+		} `json:"webPages"`
+	}
+	if err := getSearchJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var links []models.SearchResult
+	for _, item := range result.WebPages.Value {
+		links = append(links, models.SearchResult{
+			Title:   item.Name,
+			Snippet: item.Snippet,
+			Url:     item.URL,
+		})
+	}
+
+	return links, nil
+}
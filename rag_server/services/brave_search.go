@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"rag_server/models"
+	"strconv"
+	"strings"
+)
+
+// BraveProvider searches with the Brave Search API
+type BraveProvider struct {
+	APIKey string
+}
+
+func (p *BraveProvider) Name() string {
+	return "brave"
+}
+
+const (
+	// braveCount is the largest page Brave serves, its offset counting pages of that size
+	braveCount = 20
+	// maxBraveOffset is the last page Brave serves
+	maxBraveOffset = 9
+)
+
+// Search fetches as many pages as needed to gather the requested number of results
+func (p *BraveProvider) Search(query string, opts models.SearchOptions) ([]models.SearchResult, error) {
+	if p.APIKey == "" {
+		return nil, fmt.Errorf("BRAVE_API_KEY is not set")
+	}
+	if err := ValidateDateRestrict(p.Name(), opts); err != nil {
+		return nil, err
+	}
+
+	// The first page and the results to skip are picked from the offset
+	count := resultCount(opts, 100)
+	offset := resultOffset(opts)
+	page := offset / braveCount
+	skip := offset % braveCount
+
+	params := url.Values{}
+	params.Set("q", withSite(query, opts))
+	params.Set("count", strconv.Itoa(braveCount))
+	if language := languageCode(opts); language != "" {
+		params.Set("search_lang", language)
+	}
+	if opts.Country != "" {
+		params.Set("country", strings.ToUpper(opts.Country))
+	}
+	if unit, _ := datePeriod(opts); unit != 0 {
+		params.Set("freshness", "p"+string(unit))
+	}
+	switch opts.SafeSearch {
+	case "active":
+		params.Set("safesearch", "strict")
+	case "off":
+		params.Set("safesearch", "off")
+	}
+
+	var links []models.SearchResult
+	for ; len(links) < count && page <= maxBraveOffset; page++ {
+		results, err := p.searchPage(params, page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, result := range results {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(links) < count {
+				links = append(links, result)
+			}
+		}
+		if len(results) < braveCount {
+			break
+		}
+	}
+
+	return links, nil
+}
+
+func (p *BraveProvider) searchPage(params url.Values, page int) ([]models.SearchResult, error) {
+	params.Set("offset", strconv.Itoa(page))
+
+	req, err := http.NewRequest("GET", "https://api.search.brave.com/res/v1/web/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create search request: %v", err)
+	}
+	req.Header.Set("X-Subscription-Token", p.APIKey)
+
+	var result struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+				Thumbnail   struct {
+					Src string `json:"src"`
+				} `json:"thumbnail"`
+			} `json:"results"`
+		} `json:"web"`
+	}
+	if err := getSearchJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var links []models.SearchResult
+	for _, item := range result.Web.Results {
+		links = append(links, models.SearchResult{
+			Title:   item.Title,
+			Snippet: item.Description,
+			Url:     item.URL,
+			Image:   item.Thumbnail.Src,
+		})
+	}
+
+	return links, nil
+}
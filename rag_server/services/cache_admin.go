@@ -0,0 +1,53 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"rag_server/cache"
+	"rag_server/models"
+)
+
+// CacheNamespaces maps the namespaces of the cache to the prefix of their keys
+var CacheNamespaces = map[string]string{
+	"search":     "SearchCached:",
+	"embeddings": "Embedding:",
+	"sessions":   "ChatSession:",
+	"crawl_jobs": "CrawlJob:",
+}
+
+// WarmCache searches and embeds the queries so that later requests hit the cache
+func WarmCache(clients *Clients, store cache.Cache, req models.CacheWarmRequest) (models.CacheWarmResponse, error) {
+	response := models.CacheWarmResponse{Queries: len(req.Queries)}
+
+	provider, err := clients.SearchProvider(req.Provider)
+	if err != nil {
+		return response, err
+	}
+	if err := ValidateDateRestrict(provider.Name(), req.SearchOptions); err != nil {
+		return response, err
+	}
+
+	for _, query := range req.Queries {
+		if SearchWebCached(store, provider, query, req.SearchOptions, clients.SearchTTL) != nil {
+			response.Search++
+		}
+	}
+
+	if _, err := clients.Embedder.Embed(req.Queries, req.Embedding); err != nil {
+		return response, fmt.Errorf("Failed to embed queries: %v", err)
+	}
+	response.Embeddings = len(req.Queries)
+
+	return response, nil
+}
+
+// ClearAnswers removes every cached answer and returns how many were removed
+func ClearAnswers(db *sql.DB) (int, error) {
+	result, err := db.Exec(clearAnswersQuery)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to clear cached answers: %v", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return int(deleted), nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"rag_server/config"
+	"rag_server/models"
+	"strings"
+)
+
+// ChatClient sends chat requests to the OpenAI API
+type ChatClient struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// NewChatClient creates a chat client for the OpenAI API of the configuration
+func NewChatClient(cfg config.OpenAIConfig) *ChatClient {
+	return &ChatClient{
+		apiKey:  cfg.APIKey,
+		baseURL: cfg.BaseURL,
+		client:  &http.Client{},
+	}
+}
+
+// ChatCompletion sends a chat request to OpenAI and returns the first choice content
+func (c *ChatClient) ChatCompletion(chatRequest models.OpenAIChatRequest) (string, error) {
+	content, _, err := c.chatCompletion(chatRequest)
+	return content, err
+}
+
+// chatCompletion is ChatCompletion also returning the finish reason of the first choice
+func (c *ChatClient) chatCompletion(chatRequest models.OpenAIChatRequest) (string, string, error) {
+	if c.apiKey == "" {
+		return "", "", fmt.Errorf("OpenAI API key is not set")
+	}
+
+	url := c.baseURL + "/chat/completions"
+	requestBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to marshal chat request: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to create chat request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to execute chat request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		return "", "", fmt.Errorf("Chat request failed: %s", body.String())
+	}
+
+	var chatResponse models.OpenAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chatResponse); err != nil {
+		return "", "", fmt.Errorf("Failed to decode chat response: %v", err)
+	}
+
+	if len(chatResponse.Choices) == 0 || chatResponse.Choices[0].Message.Content == "" {
+		return "", "", fmt.Errorf("No chat response returned")
+	}
+
+	return chatResponse.Choices[0].Message.Content, chatResponse.Choices[0].FinishReason, nil
+}
+
+// limitCompletion caps the length of the completion, leaving it unbounded when maxTokens is not positive
+func limitCompletion(chatRequest *models.OpenAIChatRequest, maxTokens int) {
+	if maxTokens > 0 {
+		chatRequest.MaxCompletionTokens = maxTokens
+	}
+}
+
+// ChatCompletionStream sends a streamed chat request to OpenAI, calls onDelta for every
+// token delta as it arrives and returns the full content once the stream is over.
+// Cancelling ctx, e.g. when the client disconnects, aborts the upstream stream.
+func (c *ChatClient) ChatCompletionStream(ctx context.Context, chatRequest models.OpenAIChatRequest, onDelta func(string)) (string, error) {
+	content, _, err := c.chatCompletionStream(ctx, chatRequest, onDelta)
+	return content, err
+}
+
+// chatCompletionStream is ChatCompletionStream also returning the finish reason of the stream
+func (c *ChatClient) chatCompletionStream(ctx context.Context, chatRequest models.OpenAIChatRequest, onDelta func(string)) (string, string, error) {
+	if c.apiKey == "" {
+		return "", "", fmt.Errorf("OpenAI API key is not set")
+	}
+
+	chatRequest.Stream = true
+	url := c.baseURL + "/chat/completions"
+	requestBody, err := json.Marshal(chatRequest)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to marshal chat request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to create chat request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to execute chat request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		return "", "", fmt.Errorf("Chat request failed: %s", body.String())
+	}
+
+	var content strings.Builder
+	var finishReason string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk models.OpenAIChatStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return content.String(), "", fmt.Errorf("Failed to decode chat stream chunk: %v", err)
+		}
+
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			finishReason = chunk.Choices[0].FinishReason
+		}
+		if chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		content.WriteString(delta)
+		onDelta(delta)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return content.String(), "", fmt.Errorf("Failed to read chat stream: %v", err)
+	}
+
+	if content.Len() == 0 {
+		return "", "", fmt.Errorf("No chat response returned")
+	}
+
+	return content.String(), finishReason, nil
+}
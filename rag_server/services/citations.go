@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag_server/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// citationPattern matches markers such as [1] or [1, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// BuildSources turns context items into numbered sources, starting at 1
+func BuildSources(items []models.ContextItem) []models.Source {
+	sources := make([]models.Source, len(items))
+	for i, item := range items {
+		var metadata map[string]interface{}
+		_ = json.Unmarshal(item.Metadata, &metadata)
+
+		source := models.Source{
+			Index:      i + 1,
+			DocumentID: firstString(metadata, "document_id", "file_id", "doc_id"),
+			Title:      firstString(metadata, "title", "file_title", "file_name", "filename", "name"),
+			URL:        firstString(metadata, "url", "source_url", "webViewLink", "link"),
+			ChunkID:    item.ID,
+			Chunk:      item.Text,
+			Location:   chunkLocation(metadata),
+			Score:      item.Score,
+			Origin:     firstNonEmpty(item.Origin, "vector"),
+		}
+
+		// n8n loaders store either a path or a link under "source"
+		if origin := firstString(metadata, "source"); origin != "" && origin != "blob" {
+			if source.URL == "" && strings.HasPrefix(origin, "http") {
+				source.URL = origin
+			} else if source.Title == "" {
+				source.Title = origin
+			}
+		}
+
+		if source.DocumentID == "" {
+			source.DocumentID = firstNonEmpty(source.URL, item.ID)
+		}
+		if source.Title == "" {
+			source.Title = firstNonEmpty(source.URL, source.DocumentID)
+		}
+
+		sources[i] = source
+	}
+
+	return sources
+}
+
+// AnnotateCitations flags the sources referenced in the answer. Only markers whose numbers all
+// point to sources are citations, others such as a year in brackets are left untouched.
+func AnnotateCitations(answer string, sources []models.Source) (string, []models.Source) {
+	byIndex := make(map[int]*models.Source)
+	for i := range sources {
+		byIndex[sources[i].Index] = &sources[i]
+	}
+
+	annotated := citationPattern.ReplaceAllStringFunc(answer, func(marker string) string {
+		var cited []*models.Source
+		var indexes []string
+		for _, part := range strings.Split(strings.Trim(marker, "[]"), ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return marker
+			}
+			source, ok := byIndex[index]
+			if !ok {
+				return marker
+			}
+			cited = append(cited, source)
+			indexes = append(indexes, strconv.Itoa(index))
+		}
+
+		for _, source := range cited {
+			source.Cited = true
+		}
+		return "[" + strings.Join(indexes, ", ") + "]"
+	})
+
+	return annotated, sources
+}
+
+// chunkLocation describes where the chunk sits in its document, e.g. "lines 10-42", "page 3" or a heading path
+func chunkLocation(metadata map[string]interface{}) string {
+	if loc, ok := metadata["loc"].(map[string]interface{}); ok {
+		if lines, ok := loc["lines"].(map[string]interface{}); ok {
+			return fmt.Sprintf("lines %v-%v", lines["from"], lines["to"])
+		}
+		if page, ok := loc["pageNumber"]; ok {
+			return fmt.Sprintf("page %v", page)
+		}
+	}
+
+	if page, ok := metadata["page"]; ok {
+		return fmt.Sprintf("page %v", page)
+	}
+
+	if sheet, ok := metadata["sheet"]; ok {
+		return fmt.Sprintf("%v, rows %v-%v", sheet, metadata["row_from"], metadata["row_to"])
+	}
+
+	if heading, ok := metadata["heading"].(string); ok && heading != "" {
+		return heading
+	}
+
+	return ""
+}
+
+// firstString returns the first non-empty string value found under keys
+func firstString(metadata map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := metadata[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
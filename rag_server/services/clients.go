@@ -0,0 +1,53 @@
+package services
+
+import (
+	"rag_server/cache"
+	"rag_server/config"
+	"time"
+)
+
+// Clients holds the API clients built once from the configuration and shared by all requests,
+// so that rate limits, host delays and caches apply across them
+type Clients struct {
+	Chat     *ChatClient
+	Embedder *Embedder
+	Crawler  *Crawler
+
+	// SearchTTL and AnswersTTL are the lifetimes of cached search results and answers
+	SearchTTL  time.Duration
+	AnswersTTL time.Duration
+
+	search   config.SearchConfig
+	reranker config.RerankerConfig
+}
+
+// NewClients builds the clients of the configuration, the embedder reusing the embeddings cached in store
+func NewClients(cfg *config.Config, store cache.Cache) *Clients {
+	return &Clients{
+		Chat: NewChatClient(cfg.OpenAI),
+		Embedder: NewEmbedder(cfg.OpenAI, EmbedderOptions{
+			RequestsPerMinute: cfg.Embeddings.RequestsPerMinute,
+			TokensPerMinute:   cfg.Embeddings.TokensPerMinute,
+			MaxRetries:        cfg.Embeddings.MaxRetries,
+		}, NewEmbeddingCache(store, cfg.Cache.EmbeddingsTTL)),
+		Crawler: NewCrawler(CrawlerOptions{
+			Timeout:   cfg.Crawler.Timeout,
+			UserAgent: cfg.Crawler.UserAgent,
+			HostDelay: cfg.Crawler.HostDelay,
+		}),
+		SearchTTL:  cfg.Cache.SearchTTL,
+		AnswersTTL: cfg.Cache.AnswersTTL,
+		search:     cfg.Search,
+		reranker:   cfg.Reranker,
+	}
+}
+
+// SearchProvider returns the search provider registered under name, or the configured one when name is empty
+func (c *Clients) SearchProvider(name string) (SearchProvider, error) {
+	return NewSearchProvider(c.search, name)
+}
+
+// Reranker returns the reranker registered under name, grading with model when it uses the chat model
+func (c *Clients) Reranker(name, model string) (Reranker, error) {
+	return NewReranker(c.reranker, c.Chat, name, model)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"rag_server/models"
+	"rag_server/prompts"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// messageTokens is the overhead of every chat message
+	messageTokens = 4
+
+	// minItemTokens is the smallest share of the budget worth trimming or summarizing an item to
+	minItemTokens = 64
+)
+
+const summarizePrompt = `
+	Summarize the passage in at most %d tokens, keeping the facts that help answer the question.
+	Keep the language of the passage. Return only the summary.
+`
+
+// rankedItem is a context item with its position in the retrieval ranking
+type rankedItem struct {
+	rank int
+
+	// overhead counts the tokens of the item rendered around its text
+	overhead int
+	item     prompts.ContextItem
+}
+
+// FitContext keeps the context items fitting the token budget in rank order, after reserving
+// room for the prompt, the history and the answer within the context window of the model.
+// Items exceeding the budget are trimmed, dropped or summarized as set by options.
+func FitContext(chat *ChatClient, prompt *prompts.Prompt, vars prompts.Variables, model string, options models.ContextOptions) (prompts.Variables, *models.ContextUsage, error) {
+	items := vars.Context
+	vars.Context = nil
+
+	// empty is the rendered prompt without context items, base adds the history to it
+	empty, err := renderTokens(prompt, vars, model)
+	if err != nil {
+		return vars, nil, err
+	}
+	base := empty
+	for _, message := range vars.History {
+		base += CountTokens(message.Content, model) + messageTokens
+	}
+
+	usage := &models.ContextUsage{
+		Window:       ContextWindow(model),
+		PromptTokens: base,
+		AnswerTokens: options.AnswerTokens,
+	}
+	usage.Budget = min(options.ContextTokens, usage.Window-usage.PromptTokens-usage.AnswerTokens)
+	if usage.Budget <= 0 {
+		return vars, usage, fmt.Errorf("Prompt of %d tokens and answer of %d tokens exceed the context window of %s (%d tokens)",
+			usage.PromptTokens, usage.AnswerTokens, model, usage.Window)
+	}
+
+	// itemTokens is the cost of adding the item to the rendered prompt
+	itemTokens := func(item prompts.ContextItem) (int, error) {
+		withItem := vars
+		withItem.Context = []prompts.ContextItem{item}
+		tokens, err := renderTokens(prompt, withItem, model)
+		return tokens - empty, err
+	}
+
+	trim := options.ContextOverflow == "" || options.ContextOverflow == "trim"
+
+	var kept, overflow []rankedItem
+	for rank, item := range items {
+		tokens, err := itemTokens(item)
+		if err != nil {
+			return vars, nil, err
+		}
+		overhead := tokens - CountTokens(item.Text, model)
+
+		remaining := usage.Budget - usage.ContextTokens
+		if tokens <= remaining {
+			kept = append(kept, rankedItem{rank, overhead, item})
+			usage.ContextTokens += tokens
+			continue
+		}
+
+		// Trimming keeps the start of the item, as long as enough room is left to be useful
+		if trim && remaining-overhead >= minItemTokens {
+			// Text re-tokenizes differently around the cut, so shorten it until it fits
+			for limit := remaining - overhead; tokens > remaining && limit > 0; limit -= tokens - remaining {
+				item.Text = TruncateTokens(item.Text, model, limit)
+				if tokens, err = itemTokens(item); err != nil {
+					return vars, nil, err
+				}
+			}
+			if tokens <= remaining {
+				kept = append(kept, rankedItem{rank, overhead, item})
+				usage.ContextTokens += tokens
+				usage.Trimmed = append(usage.Trimmed, item.ID)
+				continue
+			}
+		}
+
+		overflow = append(overflow, rankedItem{rank, overhead, item})
+	}
+
+	if options.ContextOverflow == "summarize" && len(overflow) > 0 {
+		var summarized []rankedItem
+		summarized, overflow = summarizeOverflow(chat, overflow, vars.Question, model, usage.Budget-usage.ContextTokens)
+		for _, ranked := range summarized {
+			kept = append(kept, ranked)
+			usage.Summarized = append(usage.Summarized, ranked.item.ID)
+
+			tokens, err := itemTokens(ranked.item)
+			if err != nil {
+				return vars, nil, err
+			}
+			usage.ContextTokens += tokens
+		}
+	}
+
+	for _, ranked := range overflow {
+		usage.Dropped = append(usage.Dropped, ranked.item.ID)
+	}
+
+	// Renumber the kept items in rank order so citations follow the context
+	sort.Slice(kept, func(i, j int) bool { return kept[i].rank < kept[j].rank })
+	for i, ranked := range kept {
+		ranked.item.Index = i + 1
+		vars.Context = append(vars.Context, ranked.item)
+	}
+
+	return vars, usage, nil
+}
+
+// fittedSources returns the sources of the fitted context items, renumbered and holding the text given to the model
+func fittedSources(sources []models.Source, context []prompts.ContextItem) []models.Source {
+	byID := make(map[string]models.Source, len(sources))
+	for _, source := range sources {
+		byID[source.ChunkID] = source
+	}
+
+	fitted := make([]models.Source, len(context))
+	for i, item := range context {
+		source := byID[item.ID]
+		source.Index = item.Index
+		source.Chunk = item.Text
+		fitted[i] = source
+	}
+	return fitted
+}
+
+// summarizeOverflow condenses as many overflowing items as the remaining budget allows, sharing it
+// evenly between them, and returns the summarized items followed by the ones left out
+func summarizeOverflow(chat *ChatClient, overflow []rankedItem, question, model string, remaining int) ([]rankedItem, []rankedItem) {
+	count := min(len(overflow), remaining/minItemTokens)
+	if count == 0 {
+		return nil, overflow
+	}
+	share := remaining / count
+
+	summaries := make([]string, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		limit := share - overflow[i].overhead
+		if limit <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i, limit int) {
+			defer wg.Done()
+			item := overflow[i].item
+			summary, err := summarizeItem(chat, question, item.Text, model, limit)
+			if err != nil {
+				log.Printf("Failed to summarize chunk %s: %v", item.ID, err)
+				return
+			}
+			summaries[i] = TruncateTokens(summary, model, limit)
+		}(i, limit)
+	}
+	wg.Wait()
+
+	var summarized, left []rankedItem
+	for i, ranked := range overflow {
+		if i >= count || summaries[i] == "" {
+			left = append(left, ranked)
+			continue
+		}
+		ranked.item.Text = summaries[i]
+		summarized = append(summarized, ranked)
+	}
+	return summarized, left
+}
+
+// summarizeItem asks the chat model to condense the passage to about limit tokens
+func summarizeItem(chat *ChatClient, question, text, model string, limit int) (string, error) {
+	temperature := 0.0
+	request := models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: fmt.Sprintf(summarizePrompt, limit)},
+			{Role: "user", Content: fmt.Sprintf("Question: %s\n\nPassage:\n%s", question, text)},
+		},
+		Temperature: &temperature,
+	}
+	limitCompletion(&request, limit)
+
+	summary, err := chat.ChatCompletion(request)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// renderTokens counts the tokens of the system and user messages rendered by the prompt
+func renderTokens(prompt *prompts.Prompt, vars prompts.Variables, model string) (int, error) {
+	system, user, err := prompt.Render(vars)
+	if err != nil {
+		return 0, err
+	}
+	return CountTokens(system, model) + CountTokens(user, model) + 2*messageTokens, nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag_server/models"
+	"strings"
+)
+
+const gradePrompt = `
+	You check whether retrieved passages help answer a question.
+	Return a JSON object {"relevant": [<indices of the passages containing information that answers the question>]}.
+	Return an empty list when no passage is relevant.
+`
+
+// maxGradePassageLength truncates passages sent to the grader, in characters
+const maxGradePassageLength = 1500
+
+// GradeContext asks the chat model which context items are relevant to the question and keeps only those
+func GradeContext(chat *ChatClient, question string, items []models.ContextItem, model string) ([]models.ContextItem, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	var passages strings.Builder
+	for i, item := range items {
+		fmt.Fprintf(&passages, "[%d] %s\n\n", i, truncateRunes(item.Text, maxGradePassageLength))
+	}
+
+	temperature := 0.0
+	content, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: gradePrompt},
+			{Role: "user", Content: fmt.Sprintf("Question: %s\n\nPassages:\n%s", question, passages.String())},
+		},
+		Temperature:    &temperature,
+		ResponseFormat: &models.ResponseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to grade context: %v", err)
+	}
+
+	var grade struct {
+		Relevant []int `json:"relevant"`
+	}
+	if err := json.Unmarshal([]byte(content), &grade); err != nil {
+		return nil, fmt.Errorf("Failed to decode context grade: %v", err)
+	}
+
+	relevant := make([]bool, len(items))
+	for _, index := range grade.Relevant {
+		if index >= 0 && index < len(items) {
+			relevant[index] = true
+		}
+	}
+
+	var kept []models.ContextItem
+	for i, item := range items {
+		if relevant[i] {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept, nil
+}
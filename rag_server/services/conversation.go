@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag_server/cache"
+	"rag_server/graph"
+	"rag_server/models"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHistoryTokens = 1000
+	sessionTTL           = 7 * 24 * time.Hour
+)
+
+const condensePrompt = `
+	Rewrite the follow-up question as a standalone question, using the conversation to resolve references.
+	Keep the language of the follow-up question. Return only the rewritten question.
+`
+
+func sessionKey(sessionID string) string {
+	return fmt.Sprintf("ChatSession:%s", sessionID)
+}
+
+// LoadHistory returns the messages stored in the cache for the session
+func LoadHistory(store cache.Cache, sessionID string) ([]graph.Message, error) {
+	values, err := store.List(sessionKey(sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load session history: %v", err)
+	}
+
+	history := make([]graph.Message, 0, len(values))
+	for _, value := range values {
+		var message graph.Message
+		if err := json.Unmarshal(value, &message); err != nil {
+			continue
+		}
+		history = append(history, message)
+	}
+
+	return history, nil
+}
+
+// SaveTurn appends a question and its answer to the session history in the cache
+func SaveTurn(store cache.Cache, sessionID, question, answer string) error {
+	var values [][]byte
+	for _, message := range []graph.Message{
+		{Role: "user", Content: question},
+		{Role: "assistant", Content: answer},
+	} {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("Failed to marshal session message: %v", err)
+		}
+		values = append(values, data)
+	}
+
+	if err := store.Append(sessionKey(sessionID), values, sessionTTL); err != nil {
+		return fmt.Errorf("Failed to save session history: %v", err)
+	}
+
+	return nil
+}
+
+// CondenseQuestion rewrites a follow-up question into a standalone query using the conversation
+func CondenseQuestion(chat *ChatClient, history []graph.Message, question, model string) (string, error) {
+	if len(history) == 0 {
+		return question, nil
+	}
+
+	var conversation strings.Builder
+	for _, message := range history {
+		fmt.Fprintf(&conversation, "%s: %s\n", message.Role, message.Content)
+	}
+
+	temperature := 0.0
+	standalone, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: condensePrompt},
+			{Role: "user", Content: fmt.Sprintf("Conversation:\n%s\nFollow-up question: %s", conversation.String(), question)},
+		},
+		Temperature: &temperature,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to condense question: %v", err)
+	}
+
+	return strings.TrimSpace(standalone), nil
+}
+
+// TrimHistory keeps the most recent messages whose total token count fits the budget
+func TrimHistory(history []graph.Message, model string, budget int) []graph.Message {
+	if budget <= 0 {
+		budget = defaultHistoryTokens
+	}
+
+	used := 0
+	start := len(history)
+	for start > 0 {
+		tokens := CountTokens(history[start-1].Content, model)
+		if used+tokens > budget {
+			break
+		}
+		used += tokens
+		start--
+	}
+
+	return history[start:]
+}
@@ -1,39 +1,406 @@
 package services
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"golang.org/x/net/html/charset"
 	"io"
-	"log"
+	"mime"
 	"net/http"
+	"net/url"
+	"rag_server/models"
+	"sync"
+	"time"
 )
 
-func RetrieveUrlContents(url string) (string, error) {
-	// Fetch the URL
-	htmlContent, err := crawl(url)
+const (
+	defaultCrawlerTimeout      = 20 * time.Second
+	defaultCrawlerMaxBodySize  = 5 << 20
+	defaultCrawlerMaxRedirects = 5
+	defaultCrawlerHostDelay    = time.Second
+	defaultCrawlerUserAgent    = "rag_server-crawler/1.0 (+https://github.com/DrSmithFr/n8n)"
+
+	// maxCrawlDelay is the longest Crawl-delay honoured, hosts asking for more are skipped
+	maxCrawlDelay = 10 * time.Second
+
+	// crawlerPruneInterval is how often expired robots rules and past host slots are forgotten
+	crawlerPruneInterval = 10 * time.Minute
+)
+
+// CrawlerOptions configures a Crawler, zero values fall back to the defaults
+type CrawlerOptions struct {
+	Timeout      time.Duration
+	MaxBodySize  int64
+	MaxRedirects int
+	UserAgent    string
+
+	// HostDelay is the minimum delay between two requests to the same host,
+	// raised by the Crawl-delay of robots.txt
+	HostDelay time.Duration
+
+	// IgnoreRobots skips robots.txt checks
+	IgnoreRobots bool
+}
+
+// Crawler fetches web pages politely: it honours robots.txt, rate limits requests
+// per host, bounds time and size and decodes bodies to UTF-8
+type Crawler struct {
+	options CrawlerOptions
+	client  *http.Client
+
+	mu        sync.Mutex
+	robots    map[string]*robotsRules
+	nextFetch map[string]time.Time
+	prunedAt  time.Time
+}
+
+// Page is a fetched document, decoded to UTF-8 when it is text
+type Page struct {
+	// URL is the final URL after redirects
+	URL         string
+	StatusCode  int
+	ContentType string
+	Header      http.Header
+	Body        string
+}
+
+// UnsupportedContentTypeError is returned when a page is not of an expected content type
+type UnsupportedContentTypeError struct {
+	URL         string
+	ContentType string
+}
+
+func (e *UnsupportedContentTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q for %s", e.ContentType, e.URL)
+}
+
+// HTTPStatusError is returned when a page answers with a non 2xx status
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d for %s", e.StatusCode, e.URL)
+}
+
+// BodyTooLargeError is returned when a page exceeds the maximum body size
+type BodyTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("body of %s exceeds %d bytes", e.URL, e.Limit)
+}
+
+// RobotsDisallowedError is returned when robots.txt forbids fetching a page
+type RobotsDisallowedError struct {
+	URL string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("robots.txt disallows %s", e.URL)
+}
+
+// CrawlDelayError is returned when a host asks for a longer delay between requests than
+// the crawler waits, either through its Crawl-delay or because too many requests are queued
+type CrawlDelayError struct {
+	URL   string
+	Delay time.Duration
+}
+
+func (e *CrawlDelayError) Error() string {
+	return fmt.Sprintf("%s would be fetched after a delay of %s", e.URL, e.Delay)
+}
+
+// NewCrawler creates a crawler, applying defaults to unset options
+func NewCrawler(options CrawlerOptions) *Crawler {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultCrawlerTimeout
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = defaultCrawlerMaxBodySize
+	}
+	if options.MaxRedirects <= 0 {
+		options.MaxRedirects = defaultCrawlerMaxRedirects
+	}
+	if options.UserAgent == "" {
+		options.UserAgent = defaultCrawlerUserAgent
+	}
+	if options.HostDelay <= 0 {
+		options.HostDelay = defaultCrawlerHostDelay
+	}
+
+	c := &Crawler{
+		options:   options,
+		robots:    make(map[string]*robotsRules),
+		nextFetch: make(map[string]time.Time),
+	}
+	c.client = &http.Client{
+		Timeout:       options.Timeout,
+		CheckRedirect: c.checkRedirect,
+	}
+
+	return c
+}
+
+// checkRedirect holds redirects to the robots rules and host delays of their target
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= c.options.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", c.options.MaxRedirects)
+	}
+
+	// robots.txt itself is always fetched, checking it would loop between hosts redirecting to each other
+	if req.URL.Path != "/robots.txt" {
+		if err := c.checkRobots(req.URL); err != nil {
+			return err
+		}
+	}
+
+	return c.waitForHost(req.URL)
+}
+
+// Fetch downloads a page of any content type
+func (c *Crawler) Fetch(pageURL string) (*Page, error) {
+	return c.fetch(pageURL, nil)
+}
+
+// FetchHTMLIfModified downloads an HTML page unless it did not change since the given
+// ETag or Last-Modified value, in which case the page has a 304 status and no body
+func (c *Crawler) FetchHTMLIfModified(pageURL, etag, lastModified string) (*Page, error) {
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+
+	page, err := c.fetch(pageURL, header)
+	if err != nil || page.StatusCode == http.StatusNotModified {
+		return page, err
+	}
+
+	if err := checkHTML(page, pageURL); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// fetch downloads a page, sending the extra request headers
+func (c *Crawler) fetch(pageURL string, header http.Header) (*Page, error) {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL %q", pageURL)
+	}
+
+	if err := c.checkRobots(parsed); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.get(parsed, header)
+	var disallowed *RobotsDisallowedError
+	var delayed *CrawlDelayError
+	switch {
+	case errors.As(err, &disallowed):
+		return nil, disallowed
+	case errors.As(err, &delayed):
+		return nil, delayed
+	case err != nil:
+		return nil, fmt.Errorf("Error fetching %s: %v", pageURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return &Page{
+			URL:         resp.Request.URL.String(),
+			StatusCode:  resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Header:      resp.Header,
+		}, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &HTTPStatusError{URL: pageURL, StatusCode: resp.StatusCode}
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, c.options.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response body: %v", err)
+	}
+	if int64(len(raw)) > c.options.MaxBodySize {
+		return nil, &BodyTooLargeError{URL: pageURL, Limit: c.options.MaxBodySize}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	page := &Page{
+		URL:         resp.Request.URL.String(),
+		StatusCode:  resp.StatusCode,
+		ContentType: contentType,
+		Header:      resp.Header,
+		Body:        string(raw),
+	}
+
+	if isTextContent(contentType) {
+		decoded, err := decodeCharset(raw, contentType)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding %s: %v", pageURL, err)
+		}
+		page.Body = decoded
+	}
+
+	return page, nil
+}
+
+// checkRobots fails when robots.txt forbids fetching the target or asks for too long a delay
+func (c *Crawler) checkRobots(target *url.URL) error {
+	if c.options.IgnoreRobots {
+		return nil
+	}
+
+	rules, err := c.robotsFor(target)
 	if err != nil {
-		return "", fmt.Errorf("error fetching URL: %v", err)
+		return err
 	}
+	if !rules.allowed(target) {
+		return &RobotsDisallowedError{URL: target.String()}
+	}
+	if rules.crawlDelay > maxCrawlDelay {
+		return &CrawlDelayError{URL: target.String(), Delay: rules.crawlDelay}
+	}
+
+	return nil
+}
 
-	markdown, err := htmltomarkdown.ConvertString(htmlContent)
+// FetchHTML downloads a page and fails with an UnsupportedContentTypeError when it is not HTML
+func (c *Crawler) FetchHTML(pageURL string) (*Page, error) {
+	page, err := c.Fetch(pageURL)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return markdown, nil
+	if err := checkHTML(page, pageURL); err != nil {
+		return nil, err
+	}
+
+	return page, nil
 }
 
-func crawl(url string) (string, error) {
-	resp, err := http.Get(url)
+// get performs the request once the host rate limit allows it
+func (c *Crawler) get(target *url.URL, header http.Header) (*http.Response, error) {
+	if err := c.waitForHost(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", target.String(), nil)
 	if err != nil {
-		return "", fmt.Errorf("Error fetching HTML content: %v", err)
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.options.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	return c.client.Do(req)
+}
+
+// waitForHost blocks until the next request slot of the host and books the following one.
+// It fails without waiting when the slot is further away than the request timeout.
+func (c *Crawler) waitForHost(target *url.URL) error {
+	c.mu.Lock()
+	now := time.Now()
+	c.prune(now)
+
+	host := target.Host
+	delay := c.options.HostDelay
+	if rules, ok := c.robots[host]; ok && rules.crawlDelay > delay {
+		delay = min(rules.crawlDelay, maxCrawlDelay)
+	}
+
+	slot := c.nextFetch[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	if wait := slot.Sub(now); wait > c.options.Timeout {
+		c.mu.Unlock()
+		return &CrawlDelayError{URL: target.String(), Delay: wait}
+	}
+	c.nextFetch[host] = slot.Add(delay)
+	c.mu.Unlock()
+
+	time.Sleep(time.Until(slot))
+	return nil
+}
+
+// prune forgets the expired robots rules and the host slots already passed, c.mu must be held
+func (c *Crawler) prune(now time.Time) {
+	if now.Sub(c.prunedAt) < crawlerPruneInterval {
+		return
+	}
+	c.prunedAt = now
+
+	for host, rules := range c.robots {
+		if now.Sub(rules.fetchedAt) >= robotsTTL {
+			delete(c.robots, host)
+		}
+	}
+	for host, slot := range c.nextFetch {
+		if slot.Before(now) {
+			delete(c.nextFetch, host)
+		}
+	}
+}
+
+func checkHTML(page *Page, pageURL string) error {
+	mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return &UnsupportedContentTypeError{URL: pageURL, ContentType: page.ContentType}
+	}
+	return nil
+}
+
+func isTextContent(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "", "application/xhtml+xml", "application/xml", "application/json", "application/rss+xml", "application/atom+xml":
+		return true
+	}
+	return len(mediaType) > 5 && mediaType[:5] == "text/"
+}
+
+// decodeCharset converts the body to UTF-8 using the Content-Type header,
+// then the byte order mark and the <meta charset> of the document
+func decodeCharset(raw []byte, contentType string) (string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(raw), contentType)
+	if err != nil {
+		return "", err
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+// RetrieveUrlContents fetches a page and returns its main content as markdown with its metadata
+func (c *Crawler) RetrieveUrlContents(url string) (*models.WebPage, error) {
+	// Fetch the URL
+	page, err := c.FetchHTML(url)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching URL: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	// Isolate the article from navigation, banners and footers before converting it
+	article, err := ExtractArticle(page.Body, page.URL)
 	if err != nil {
-		return "", fmt.Errorf("Error reading response body: %v", err)
+		return nil, err
 	}
 
-	return string(body), nil
+	return article, nil
 }
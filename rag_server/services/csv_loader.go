@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"rag_server/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVLoader renders each row with its column names and groups consecutive rows into chunks
+type CSVLoader struct{}
+
+func (CSVLoader) Load(data []byte, filename string) ([]models.DocumentChunk, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = csvDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CSV %s: %v", filename, err)
+	}
+
+	sheet := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+
+	var chunks []models.DocumentChunk
+	var text strings.Builder
+	firstRow := 0
+
+	// length counts the characters of text, chunk sizes are in characters like SplitText
+	length := 0
+
+	flush := func(lastRow int) {
+		if text.Len() == 0 {
+			return
+		}
+		chunks = append(chunks, models.DocumentChunk{
+			Text: strings.TrimSpace(text.String()),
+			Metadata: map[string]interface{}{
+				"sheet":    sheet,
+				"row_from": firstRow,
+				"row_to":   lastRow,
+			},
+		})
+		text.Reset()
+		length = 0
+	}
+
+	// Rows are numbered like in a spreadsheet, the header being row 1
+	row := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read CSV %s: %v", filename, err)
+		}
+		row++
+
+		var fields []string
+		for i, value := range record {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			if i < len(header) && header[i] != "" {
+				value = header[i] + ": " + value
+			}
+			fields = append(fields, value)
+		}
+		line := strings.Join(fields, " | ")
+		lineLength := utf8.RuneCountInString(line)
+
+		if length > 0 && length+lineLength > defaultChunkSize {
+			flush(row - 1)
+		}
+		if length == 0 {
+			firstRow = row
+		}
+		text.WriteString(line)
+		text.WriteString("\n")
+		length += lineLength + 1
+	}
+	flush(row)
+
+	return chunks, nil
+}
+
+// csvDelimiter picks ";" over "," when the header uses it more, as spreadsheets do in French locales
+func csvDelimiter(data []byte) rune {
+	header := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		header = data[:i]
+	}
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
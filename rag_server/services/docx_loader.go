@@ -0,0 +1,119 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"rag_server/models"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxDocumentXMLSize bounds the decompressed body of a Word document
+const maxDocumentXMLSize = 64 << 20
+
+// headingStyle matches the built-in heading styles of Word, in English or French
+var headingStyle = regexp.MustCompile(`(?i)^(heading|titre|title)\s*(\d)?$`)
+
+// DOCXLoader extracts the paragraphs of a Word document, grouped under their headings
+type DOCXLoader struct{}
+
+func (DOCXLoader) Load(data []byte, filename string) ([]models.DocumentChunk, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open DOCX %s: %v", filename, err)
+	}
+
+	var document []byte
+	for _, file := range archive.File {
+		if file.Name == "word/document.xml" {
+			if document, err = readZipFile(file, maxDocumentXMLSize); err != nil {
+				return nil, fmt.Errorf("Failed to open DOCX %s: %v", filename, err)
+			}
+			break
+		}
+	}
+	if document == nil {
+		return nil, fmt.Errorf("Failed to open DOCX %s: word/document.xml is missing", filename)
+	}
+
+	current := &section{}
+	sections := []*section{current}
+
+	var paragraph strings.Builder
+	style := ""
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse DOCX %s: %v", filename, err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			switch element.Name.Local {
+			case "p":
+				paragraph.Reset()
+				style = ""
+			case "pStyle":
+				for _, a := range element.Attr {
+					if a.Name.Local == "val" {
+						style = a.Value
+					}
+				}
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			}
+
+		case xml.CharData:
+			paragraph.Write(element)
+
+		case xml.EndElement:
+			if element.Name.Local != "p" {
+				continue
+			}
+
+			text := strings.TrimSpace(paragraph.String())
+			if text == "" {
+				continue
+			}
+
+			if match := headingStyle.FindStringSubmatch(style); match != nil {
+				level, _ := strconv.Atoi(match[2])
+				current = &section{Headings: headingPath(current.Headings, level, text)}
+				sections = append(sections, current)
+			}
+			current.Text.WriteString(text)
+			current.Text.WriteString("\n\n")
+		}
+	}
+
+	return sectionChunks(sections), nil
+}
+
+// readZipFile decompresses an archive entry, failing once it exceeds limit bytes whatever size its header claims
+func readZipFile(file *zip.File, limit int64) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s exceeds %d bytes once decompressed", file.Name, limit)
+	}
+	return data, nil
+}
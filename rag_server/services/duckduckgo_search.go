@@ -0,0 +1,201 @@
+package services
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"net/http"
+	"net/url"
+	"rag_server/models"
+	"strconv"
+	"strings"
+)
+
+// DuckDuckGoProvider scrapes the DuckDuckGo HTML endpoint, it needs no API key
+type DuckDuckGoProvider struct{}
+
+func (p *DuckDuckGoProvider) Name() string {
+	return "duckduckgo"
+}
+
+const (
+	// duckDuckGoPageSize is the number of results of a DuckDuckGo HTML page
+	duckDuckGoPageSize = 30
+	// maxDuckDuckGoPages bounds the pages fetched for a single search
+	maxDuckDuckGoPages = 5
+)
+
+// Search fetches as many pages as needed to gather the requested number of results
+func (p *DuckDuckGoProvider) Search(query string, opts models.SearchOptions) ([]models.SearchResult, error) {
+	if err := ValidateDateRestrict(p.Name(), opts); err != nil {
+		return nil, err
+	}
+
+	// The first page and the results to skip are picked from the offset
+	count := resultCount(opts, 100)
+	offset := resultOffset(opts)
+	page := offset / duckDuckGoPageSize
+	skip := offset % duckDuckGoPageSize
+
+	form := url.Values{}
+	form.Set("q", withSite(query, opts))
+	if region := locale(opts); region != "" {
+		parts := strings.SplitN(strings.ToLower(region), "-", 2)
+		form.Set("kl", parts[1]+"-"+parts[0])
+	}
+	if unit, _ := datePeriod(opts); unit != 0 {
+		form.Set("df", string(unit))
+	}
+	switch opts.SafeSearch {
+	case "active":
+		form.Set("kp", "1")
+	case "off":
+		form.Set("kp", "-2")
+	}
+
+	var links []models.SearchResult
+	for fetched := 0; len(links) < count && fetched < maxDuckDuckGoPages; fetched++ {
+		results, err := p.searchPage(form, (page+fetched)*duckDuckGoPageSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			break
+		}
+
+		for _, result := range results {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(links) < count {
+				links = append(links, result)
+			}
+		}
+	}
+
+	return links, nil
+}
+
+func (p *DuckDuckGoProvider) searchPage(form url.Values, offset int) ([]models.SearchResult, error) {
+	form.Del("s")
+	form.Del("dc")
+	if offset > 0 {
+		form.Set("s", strconv.Itoa(offset))
+		form.Set("dc", strconv.Itoa(offset+1))
+	}
+
+	req, err := http.NewRequest("POST", "https://html.duckduckgo.com/html/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create search request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; rag_server)")
+
+	resp, err := searchClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to execute search request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Search request failed with status %s", resp.Status)
+	}
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse search response: %v", err)
+	}
+
+	var links []models.SearchResult
+	for _, result := range findAll(doc, func(n *html.Node) bool { return hasClass(n, "result__body") }) {
+		anchors := findAll(result, func(n *html.Node) bool { return n.Data == "a" && hasClass(n, "result__a") })
+		if len(anchors) == 0 {
+			continue
+		}
+
+		link := models.SearchResult{
+			Title: textContent(anchors[0]),
+			Url:   duckDuckGoTarget(attr(anchors[0], "href")),
+		}
+		if snippets := findAll(result, func(n *html.Node) bool { return hasClass(n, "result__snippet") }); len(snippets) > 0 {
+			link.Snippet = textContent(snippets[0])
+		}
+
+		if link.Url != "" {
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+// duckDuckGoTarget unwraps the redirect links such as //duckduckgo.com/l/?uddg=<url>
+func duckDuckGoTarget(href string) string {
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	if target := parsed.Query().Get("uddg"); target != "" {
+		return target
+	}
+	if parsed.Scheme == "" {
+		parsed.Scheme = "https"
+	}
+
+	return parsed.String()
+}
+
+// findAll returns the element nodes below n matching the predicate, in document order
+func findAll(n *html.Node, match func(*html.Node) bool) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && match(node) {
+			found = append(found, node)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return found
+}
+
+// attr returns the value of the attribute key of n, or an empty string
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// textContent returns the text of n and its descendants with collapsed whitespace
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			b.WriteString(node.Data)
+			b.WriteString(" ")
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
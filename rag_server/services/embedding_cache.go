@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"log"
+	"math"
+	"rag_server/cache"
+	"rag_server/models"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EmbeddingCache stores embeddings as little endian float32 values
+type EmbeddingCache struct {
+	store cache.Cache
+	ttl   time.Duration
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewEmbeddingCache creates an embedding cache on the store, keeping embeddings for ttl
+func NewEmbeddingCache(store cache.Cache, ttl time.Duration) *EmbeddingCache {
+	return &EmbeddingCache{store: store, ttl: ttl}
+}
+
+// Stats returns the hit and miss counters of the cache
+func (c *EmbeddingCache) Stats() models.CacheStats {
+	stats := models.CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// lookup returns the cached embedding of each text, nil when missing
+func (c *EmbeddingCache) lookup(texts []string, model string) [][]float64 {
+	embeddings := make([][]float64, len(texts))
+
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = embeddingCacheKey(text, model)
+	}
+
+	values, err := c.store.GetMany(keys)
+	if err != nil {
+		log.Printf("Failed to read embedding cache: %v", err)
+	}
+
+	for i, data := range values {
+		embeddings[i] = decodeEmbedding(data)
+		if embeddings[i] != nil {
+			c.hits.Add(1)
+		} else {
+			c.misses.Add(1)
+		}
+	}
+
+	return embeddings
+}
+
+// save caches the embeddings of the texts
+func (c *EmbeddingCache) save(texts []string, embeddings [][]float64, model string) {
+	values := make(map[string][]byte, len(texts))
+	for i, text := range texts {
+		values[embeddingCacheKey(text, model)] = encodeEmbedding(embeddings[i])
+	}
+
+	if err := c.store.SetMany(values, c.ttl); err != nil {
+		log.Printf("Failed to write embedding cache: %v", err)
+	}
+}
+
+// embeddingCacheKey identifies a text by the hash of its normalised form, so that
+// whitespace and Unicode composition differences share the same embedding
+func embeddingCacheKey(text, model string) string {
+	normalised := strings.Join(strings.Fields(norm.NFC.String(text)), " ")
+	hash := sha256.Sum256([]byte(normalised))
+	return fmt.Sprintf("Embedding:%s:%s", model, hex.EncodeToString(hash[:]))
+}
+
+func encodeEmbedding(embedding []float64) []byte {
+	data := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(value)))
+	}
+	return data
+}
+
+func decodeEmbedding(data []byte) []float64 {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil
+	}
+
+	embedding := make([]float64, len(data)/4)
+	for i := range embedding {
+		embedding[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+	}
+	return embedding
+}
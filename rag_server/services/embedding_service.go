@@ -4,56 +4,275 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
-	"os"
+	"rag_server/config"
 	"rag_server/models"
+	"strconv"
+	"time"
 )
 
-// GetEmbedding retrieves the embedding vector for the given text
-func GetEmbedding(text, model string) ([]float64, error) {
-	openAIAPIKey := os.Getenv("OPENAI_API_KEY")
-	if openAIAPIKey == "" {
-		return nil, fmt.Errorf("OpenAI API key is not set")
+const (
+	// OpenAI accepts up to 2048 inputs and 300k tokens per embedding request,
+	// and 8191 tokens per input
+	defaultEmbeddingBatchInputs = 2048
+	defaultEmbeddingBatchTokens = 300000
+	defaultEmbeddingInputTokens = 8191
+
+	defaultEmbeddingRequestsPerMinute = 3000
+	defaultEmbeddingTokensPerMinute   = 1000000
+	defaultEmbeddingMaxRetries        = 5
+
+	maxEmbeddingBackoff = time.Minute
+)
+
+// EmbedderOptions configures an Embedder, zero values fall back to the defaults
+type EmbedderOptions struct {
+	MaxBatchInputs int
+	MaxBatchTokens int
+	MaxInputTokens int
+
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// MaxRetries of zero disables retries, a negative value falls back to the default
+	MaxRetries int
+}
+
+// Embedder embeds texts in batches, within the rate limits of the API
+type Embedder struct {
+	apiKey  string
+	baseURL string
+	options EmbedderOptions
+	limiter *rateLimiter
+	client  *http.Client
+
+	// cache is consulted before the API when set
+	cache *EmbeddingCache
+}
+
+// embeddingBatch is a run of consecutive inputs sent in one request
+type embeddingBatch struct {
+	Offset int
+	Inputs []string
+	Tokens int
+}
+
+// NewEmbedder creates an embedder for the OpenAI API of the configuration, applying defaults
+// to unset options. The cache, when not nil, is consulted before the API.
+func NewEmbedder(cfg config.OpenAIConfig, options EmbedderOptions, cache *EmbeddingCache) *Embedder {
+	if options.MaxBatchInputs <= 0 {
+		options.MaxBatchInputs = defaultEmbeddingBatchInputs
+	}
+	if options.MaxBatchTokens <= 0 {
+		options.MaxBatchTokens = defaultEmbeddingBatchTokens
+	}
+	if options.MaxInputTokens <= 0 {
+		options.MaxInputTokens = defaultEmbeddingInputTokens
+	}
+	if options.RequestsPerMinute <= 0 {
+		options.RequestsPerMinute = defaultEmbeddingRequestsPerMinute
+	}
+	if options.TokensPerMinute <= 0 {
+		options.TokensPerMinute = defaultEmbeddingTokensPerMinute
+	}
+	if options.MaxRetries < 0 {
+		options.MaxRetries = defaultEmbeddingMaxRetries
 	}
 
-	url := "https://api.openai.com/v1/embeddings"
-	requestBody, err := json.Marshal(models.OpenAIEmbeddingRequest{
-		Input: text,
-		Model: model,
-	})
+	return &Embedder{
+		apiKey:  cfg.APIKey,
+		baseURL: cfg.BaseURL,
+		options: options,
+		limiter: newRateLimiter(options.RequestsPerMinute, options.TokensPerMinute),
+		client:  &http.Client{Timeout: 2 * time.Minute},
+		cache:   cache,
+	}
+}
 
+// EmbedText retrieves the embedding vector for the given text
+func (e *Embedder) EmbedText(text, model string) ([]float64, error) {
+	embeddings, err := e.Embed([]string{text}, model)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to marshal embedding request: %v", err)
+		return nil, err
 	}
+	return embeddings[0], nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, fmt.Errorf("Failed to create embedding request: %v", err)
+// CacheStats returns the counters of the embedding cache, zero when the embedder has none
+func (e *Embedder) CacheStats() models.CacheStats {
+	if e.cache == nil {
+		return models.CacheStats{}
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", openAIAPIKey))
+	return e.cache.Stats()
+}
+
+// Embed retrieves the embedding vectors of texts, in input order, from the cache when
+// possible and otherwise in as few requests as the limits allow
+func (e *Embedder) Embed(texts []string, model string) ([][]float64, error) {
+	if e.cache == nil {
+		return e.embed(texts, model)
+	}
+
+	embeddings := e.cache.lookup(texts, model)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	var missing []string
+	var positions []int
+	for i, embedding := range embeddings {
+		if embedding == nil {
+			missing = append(missing, texts[i])
+			positions = append(positions, i)
+		}
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := e.embed(missing, model)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to execute embedding request: %v", err)
+		return nil, err
+	}
+	e.cache.save(missing, computed, model)
+
+	for i, position := range positions {
+		embeddings[position] = computed[i]
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body := new(bytes.Buffer)
-		body.ReadFrom(resp.Body)
-		return nil, fmt.Errorf("Embedding request failed: %s", body.String())
+	return embeddings, nil
+}
+
+// embed calls the API for every text. Inputs longer than the model limit are truncated.
+func (e *Embedder) embed(texts []string, model string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+
+	for _, batch := range e.batches(texts, model) {
+		e.limiter.wait(batch.Tokens)
+
+		response, err := e.request(batch.Inputs, model)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(response.Data) != len(batch.Inputs) {
+			return nil, fmt.Errorf("Embedding request returned %d embeddings for %d inputs", len(response.Data), len(batch.Inputs))
+		}
+		for _, data := range response.Data {
+			if data.Index < 0 || data.Index >= len(batch.Inputs) {
+				return nil, fmt.Errorf("Embedding request returned an unknown index %d", data.Index)
+			}
+			embeddings[batch.Offset+data.Index] = data.Embedding
+		}
+	}
+
+	return embeddings, nil
+}
+
+// batches groups consecutive inputs while they fit the per-request input and token limits
+func (e *Embedder) batches(texts []string, model string) []embeddingBatch {
+	var batches []embeddingBatch
+	current := embeddingBatch{}
+
+	for i, text := range texts {
+		// The API rejects empty inputs
+		if text == "" {
+			text = " "
+		}
+
+		tokens := CountTokens(text, model)
+		if tokens > e.options.MaxInputTokens {
+			text = TruncateTokens(text, model, e.options.MaxInputTokens)
+			tokens = e.options.MaxInputTokens
+		}
+
+		if len(current.Inputs) > 0 && (len(current.Inputs) >= e.options.MaxBatchInputs || current.Tokens+tokens > e.options.MaxBatchTokens) {
+			batches = append(batches, current)
+			current = embeddingBatch{Offset: i}
+		}
+
+		current.Inputs = append(current.Inputs, text)
+		current.Tokens += tokens
 	}
 
-	var embeddingResponse models.OpenAIEmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embeddingResponse); err != nil {
-		return nil, fmt.Errorf("Failed to decode embedding response: %v", err)
+	if len(current.Inputs) > 0 {
+		batches = append(batches, current)
 	}
 
-	if len(embeddingResponse.Data) == 0 {
-		return nil, fmt.Errorf("No embedding data returned")
+	return batches
+}
+
+// request sends one embedding request, retrying rate limited and failed attempts with backoff
+func (e *Embedder) request(inputs []string, model string) (*models.OpenAIEmbeddingResponse, error) {
+	if e.apiKey == "" {
+		return nil, fmt.Errorf("OpenAI API key is not set")
 	}
 
-	return embeddingResponse.Data[0].Embedding, nil
+	url := e.baseURL + "/embeddings"
+	requestBody, err := json.Marshal(models.OpenAIEmbeddingRequest{
+		Input: inputs,
+		Model: model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal embedding request: %v", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create embedding request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", e.apiKey))
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			if attempt < e.options.MaxRetries {
+				time.Sleep(embeddingBackoff(attempt, nil))
+				continue
+			}
+			return nil, fmt.Errorf("Failed to execute embedding request: %v", err)
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if retryable && attempt < e.options.MaxRetries {
+			resp.Body.Close()
+			time.Sleep(embeddingBackoff(attempt, resp))
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body := new(bytes.Buffer)
+			body.ReadFrom(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("Embedding request failed: %s %s", resp.Status, body.String())
+		}
+
+		var embeddingResponse models.OpenAIEmbeddingResponse
+		err = json.NewDecoder(resp.Body).Decode(&embeddingResponse)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode embedding response: %v", err)
+		}
+
+		return &embeddingResponse, nil
+	}
+}
+
+// embeddingBackoff honours the Retry-After header of the response, or else backs off
+// exponentially with jitter. Both wait at most maxEmbeddingBackoff.
+func embeddingBackoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		// Compare in the header unit, a huge value would overflow once converted to a duration
+		if ms, err := strconv.ParseInt(resp.Header.Get("Retry-After-Ms"), 10, 64); err == nil && ms > 0 {
+			return time.Duration(min(ms, maxEmbeddingBackoff.Milliseconds())) * time.Millisecond
+		}
+		if seconds, err := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 64); err == nil && seconds > 0 {
+			return time.Duration(min(seconds, int64(maxEmbeddingBackoff/time.Second))) * time.Second
+		}
+	}
+
+	backoff := time.Second << attempt
+	if backoff > maxEmbeddingBackoff {
+		backoff = maxEmbeddingBackoff
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
 }
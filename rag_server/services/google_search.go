@@ -1,16 +1,13 @@
 package services
 
 import (
-	"encoding/json"
 	"fmt"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
 	"net/http"
-	"os"
-	"rag_server/cache"
+	neturl "net/url"
 	"rag_server/models"
 	"strings"
-	"time"
 	"unicode"
 )
 
@@ -39,17 +36,73 @@ func isNonSpacingMark(r rune) bool {
 	return unicode.Is(unicode.Mn, r) // Mn: nonspacing marks
 }
 
-// searchGoogle performs the actual Google Custom Search API call
-func searchGoogle(query string) []models.GoogleSearchResult {
-	apiKey := os.Getenv("GOOGLE_API_KEY")
-	cseId := os.Getenv("CSE_ID")
-	url := fmt.Sprintf("https://www.googleapis.com/customsearch/v1?q=%s&key=%s&cx=%s", queryToParameter(query), apiKey, cseId)
-	resp, err := http.Get(url)
+// GoogleProvider searches with the Google Custom Search JSON API
+type GoogleProvider struct {
+	APIKey string
+	CseID  string
+}
+
+func (p *GoogleProvider) Name() string {
+	return "google"
+}
+
+// Search performs the actual Google Custom Search API calls, one per page of 10 results
+func (p *GoogleProvider) Search(query string, opts models.SearchOptions) ([]models.SearchResult, error) {
+	if p.APIKey == "" || p.CseID == "" {
+		return nil, fmt.Errorf("GOOGLE_API_KEY or CSE_ID is not set")
+	}
+
+	// The API serves at most 10 results per call and rejects calls where start + num exceeds 100
+	count := resultCount(opts, 100)
+	start := resultOffset(opts) + 1
+
+	var links []models.SearchResult
+	for len(links) < count && start < 100 {
+		num := min(count-len(links), 10, 100-start)
+
+		page, err := p.searchPage(query, opts, start, num)
+		if err != nil {
+			return nil, err
+		}
+
+		links = append(links, page...)
+		if len(page) < num {
+			break
+		}
+		start += num
+	}
+
+	return links, nil
+}
+
+func (p *GoogleProvider) searchPage(query string, opts models.SearchOptions, start, num int) ([]models.SearchResult, error) {
+	url := fmt.Sprintf("https://www.googleapis.com/customsearch/v1?q=%s&key=%s&cx=%s&start=%d&num=%d", queryToParameter(query), p.APIKey, p.CseID, start, num)
+
+	params := neturl.Values{}
+	if opts.Language != "" {
+		params.Set("lr", "lang_"+languageCode(opts))
+	}
+	if opts.Country != "" {
+		params.Set("gl", strings.ToLower(opts.Country))
+	}
+	if opts.DateRestrict != "" {
+		params.Set("dateRestrict", opts.DateRestrict)
+	}
+	if opts.SiteSearch != "" {
+		params.Set("siteSearch", opts.SiteSearch)
+		params.Set("siteSearchFilter", "i")
+	}
+	if opts.SafeSearch != "" {
+		params.Set("safe", opts.SafeSearch)
+	}
+	if len(params) > 0 {
+		url += "&" + params.Encode()
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		fmt.Println("Error during Google Custom Search:", err)
-		return nil
+		return nil, fmt.Errorf("Failed to create search request: %v", err)
 	}
-	defer resp.Body.Close()
 
 	var result struct {
 		Items []struct {
@@ -61,14 +114,13 @@ func searchGoogle(query string) []models.GoogleSearchResult {
 			} `json:"pagemap"`
 		} `json:"items"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		fmt.Println("Error decoding JSON response:", err)
-		return nil
+	if err := getSearchJSON(req, &result); err != nil {
+		return nil, err
 	}
 
-	var links []models.GoogleSearchResult
+	var links []models.SearchResult
 	for _, item := range result.Items {
-		link := models.GoogleSearchResult{
+		link := models.SearchResult{
 			Title:   item.Title,
 			Snippet: item.Snippet,
 			Url:     item.Link,
@@ -93,40 +145,5 @@ func searchGoogle(query string) []models.GoogleSearchResult {
 		links = append(links, link)
 	}
 
-	return links
-}
-
-// SearchGoogleCached searches Google and caches the result in Redis
-func SearchGoogleCached(query string) []models.GoogleSearchResult {
-	rdb, ctx := cache.InitCache()
-	cacheKey := fmt.Sprintf("GoogleSearchCached:%s", query)
-
-	// Step 1: Check if the result is already in cache
-	cachedData, err := rdb.Get(ctx, cacheKey).Result()
-	if err == nil && cachedData != "" {
-		// If cache hit, unmarshal and return
-		var cachedResults []models.GoogleSearchResult
-		if err := json.Unmarshal([]byte(cachedData), &cachedResults); err == nil {
-			fmt.Println("Cache hit: Returning cached results")
-			return cachedResults
-		}
-	}
-
-	// Step 2: If not cached, perform the actual Google search
-	results := searchGoogle(query)
-	if results == nil {
-		fmt.Println("No results found from Google API")
-		return nil
-	}
-
-	// Step 3: Store the result in cache for future use
-	jsonData, err := json.Marshal(results)
-	if err == nil {
-		err = rdb.Set(ctx, cacheKey, jsonData, 24*time.Hour).Err() // Cache for 24 hours
-		if err != nil {
-			fmt.Println("Error caching results:", err)
-		}
-	}
-
-	return results
+	return links, nil
 }
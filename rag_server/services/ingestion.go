@@ -0,0 +1,84 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"rag_server/models"
+)
+
+// IngestDocument splits a document into chunks, embeds them and stores them in n8n_vectors.
+// Chunks previously stored under the same document_id are replaced.
+func IngestDocument(embedder *Embedder, db *sql.DB, text string, metadata map[string]interface{}, model string) (int, error) {
+	var chunks []models.DocumentChunk
+	for _, chunk := range SplitText(text, defaultChunkSize, defaultChunkOverlap) {
+		chunks = append(chunks, models.DocumentChunk{Text: chunk})
+	}
+	return IngestChunks(embedder, db, chunks, metadata, model)
+}
+
+// IngestChunks embeds chunks and stores them in n8n_vectors with the document metadata merged
+// into theirs. Chunks previously stored under the same document_id are replaced and the cached
+// answers citing the document are dropped.
+func IngestChunks(embedder *Embedder, db *sql.DB, chunks []models.DocumentChunk, metadata map[string]interface{}, model string) (int, error) {
+	if len(chunks) == 0 {
+		return 0, nil
+	}
+
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+
+	embeddings, err := embedder.Embed(texts, model)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to generate embeddings: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to start ingestion: %v", err)
+	}
+	defer tx.Rollback()
+
+	if documentID, _ := metadata["document_id"].(string); documentID != "" {
+		if _, err := tx.Exec(`DELETE FROM n8n_vectors WHERE metadata->>'document_id' = $1;`, documentID); err != nil {
+			return 0, fmt.Errorf("Failed to delete previous chunks: %v", err)
+		}
+	}
+
+	// A new or updated document may change the answer of any question, not only of those citing it
+	if _, err := tx.Exec(clearAnswersQuery); err != nil {
+		return 0, fmt.Errorf("Failed to invalidate cached answers: %v", err)
+	}
+
+	for i, chunk := range chunks {
+		chunkMetadata := make(map[string]interface{}, len(metadata)+len(chunk.Metadata)+2)
+		for key, value := range metadata {
+			chunkMetadata[key] = value
+		}
+		for key, value := range chunk.Metadata {
+			chunkMetadata[key] = value
+		}
+		chunkMetadata["chunk"] = i
+		chunkMetadata["chunks"] = len(chunks)
+
+		data, err := json.Marshal(chunkMetadata)
+		if err != nil {
+			return 0, fmt.Errorf("Failed to marshal chunk metadata: %v", err)
+		}
+
+		if _, err := tx.Exec(
+			`INSERT INTO n8n_vectors (text, metadata, embedding) VALUES ($1, $2, $3);`,
+			chunk.Text, data, ToVectorString(embeddings[i]),
+		); err != nil {
+			return 0, fmt.Errorf("Failed to insert chunk: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("Failed to commit ingestion: %v", err)
+	}
+
+	return len(chunks), nil
+}
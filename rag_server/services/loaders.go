@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"mime"
+	"path/filepath"
+	"rag_server/models"
+	"strings"
+)
+
+// Loader extracts the text of a file as chunks carrying their position in the document
+type Loader interface {
+	Load(data []byte, filename string) ([]models.DocumentChunk, error)
+}
+
+const docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// loaders is the registry of loaders keyed by MIME type
+var loaders = map[string]Loader{
+	"application/pdf":       PDFLoader{},
+	docxMimeType:            DOCXLoader{},
+	"text/html":             HTMLLoader{},
+	"application/xhtml+xml": HTMLLoader{},
+	"text/markdown":         MarkdownLoader{},
+	"text/x-markdown":       MarkdownLoader{},
+	"text/csv":              CSVLoader{},
+	"text/plain":            TextLoader{},
+}
+
+// extensionMimeTypes complements the system MIME table, which often lacks these
+var extensionMimeTypes = map[string]string{
+	".pdf":      "application/pdf",
+	".docx":     docxMimeType,
+	".html":     "text/html",
+	".htm":      "text/html",
+	".md":       "text/markdown",
+	".markdown": "text/markdown",
+	".csv":      "text/csv",
+	".txt":      "text/plain",
+}
+
+// RegisterLoader adds or replaces the loader of a MIME type
+func RegisterLoader(mimeType string, loader Loader) {
+	loaders[mimeType] = loader
+}
+
+// DetectMimeType returns the MIME type of a file from its declared content type,
+// falling back to its extension when the type is missing or generic
+func DetectMimeType(contentType, filename string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if _, ok := loaders[mediaType]; ok {
+		return mediaType
+	}
+
+	extension := strings.ToLower(filepath.Ext(filename))
+	if mimeType, ok := extensionMimeTypes[extension]; ok {
+		return mimeType
+	}
+	if mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(extension)); mimeType != "" {
+		return mimeType
+	}
+
+	return mediaType
+}
+
+// LoaderFor returns the loader registered for the MIME type
+func LoaderFor(mimeType string) (Loader, error) {
+	loader, ok := loaders[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported file type %q", mimeType)
+	}
+	return loader, nil
+}
+
+// section is a part of a document under a heading path
+type section struct {
+	Headings []string
+	Text     strings.Builder
+}
+
+// sectionChunks splits each section into chunks tagged with its heading path
+func sectionChunks(sections []*section) []models.DocumentChunk {
+	var chunks []models.DocumentChunk
+	for _, s := range sections {
+		for _, text := range SplitText(s.Text.String(), defaultChunkSize, defaultChunkOverlap) {
+			metadata := make(map[string]interface{})
+			if len(s.Headings) > 0 {
+				metadata["heading"] = strings.Join(s.Headings, " > ")
+			}
+			chunks = append(chunks, models.DocumentChunk{Text: text, Metadata: metadata})
+		}
+	}
+	return chunks
+}
+
+// headingPath returns the headings above a new heading of the level, followed by it
+func headingPath(headings []string, level int, title string) []string {
+	if level < 1 {
+		level = 1
+	}
+	if len(headings) >= level {
+		headings = headings[:level-1]
+	}
+	path := append([]string{}, headings...)
+	return append(path, title)
+}
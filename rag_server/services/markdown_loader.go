@@ -0,0 +1,65 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"rag_server/models"
+	"regexp"
+	"strings"
+)
+
+// markdownHeading matches ATX headings such as "## Title"
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// MarkdownLoader splits a markdown document by headings
+type MarkdownLoader struct{}
+
+func (MarkdownLoader) Load(data []byte, filename string) ([]models.DocumentChunk, error) {
+	return markdownChunks(string(data)), nil
+}
+
+// HTMLLoader extracts the main content of an HTML page and splits it by headings
+type HTMLLoader struct{}
+
+func (HTMLLoader) Load(data []byte, filename string) ([]models.DocumentChunk, error) {
+	page, err := ExtractArticle(string(data), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := markdownChunks(page.Markdown)
+	for _, chunk := range chunks {
+		if page.Title != "" {
+			chunk.Metadata["title"] = page.Title
+		}
+	}
+
+	return chunks, nil
+}
+
+func markdownChunks(markdown string) []models.DocumentChunk {
+	current := &section{}
+	sections := []*section{current}
+	inCode := false
+
+	scanner := bufio.NewScanner(bytes.NewReader([]byte(markdown)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Lines starting with # inside code blocks are comments, not headings
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+		}
+
+		if match := markdownHeading.FindStringSubmatch(line); match != nil && !inCode {
+			current = &section{Headings: headingPath(current.Headings, len(match[1]), match[2])}
+			sections = append(sections, current)
+		}
+
+		current.Text.WriteString(line)
+		current.Text.WriteString("\n")
+	}
+
+	return sectionChunks(sections)
+}
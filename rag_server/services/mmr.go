@@ -0,0 +1,72 @@
+package services
+
+import (
+	"math"
+	"rag_server/models"
+)
+
+const defaultMMRLambda = 0.5
+
+// MaximalMarginalRelevance greedily selects k items that are relevant to the query
+// while penalising items similar to the ones already selected.
+// lambda = 1 ranks by relevance only, lambda = 0 by diversity only.
+func MaximalMarginalRelevance(queryEmbedding []float64, items []models.ContextItem, k int, lambda float64) []models.ContextItem {
+	if k <= 0 || k > len(items) {
+		k = len(items)
+	}
+
+	relevance := make([]float64, len(items))
+	for i, item := range items {
+		relevance[i] = CosineSimilarity(queryEmbedding, item.Embedding)
+	}
+
+	selected := make([]models.ContextItem, 0, k)
+	picked := make([]bool, len(items))
+	// redundancy[i] is the highest similarity between item i and any selected item
+	redundancy := make([]float64, len(items))
+
+	for len(selected) < k {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range items {
+			if picked[i] {
+				continue
+			}
+
+			score := lambda*relevance[i] - (1-lambda)*redundancy[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+
+		picked[best] = true
+		selected = append(selected, items[best])
+
+		for i := range items {
+			if !picked[i] {
+				redundancy[i] = math.Max(redundancy[i], CosineSimilarity(items[i].Embedding, items[best].Embedding))
+			}
+		}
+	}
+
+	return selected
+}
+
+// CosineSimilarity returns the cosine of the angle between a and b, or 0 when it is undefined
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
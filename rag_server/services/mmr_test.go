@@ -0,0 +1,59 @@
+package services
+
+import (
+	"math"
+	"rag_server/models"
+	"testing"
+)
+
+func TestMaximalMarginalRelevance(t *testing.T) {
+	query := []float64{1, 0}
+	items := []models.ContextItem{
+		{ID: "a", Embedding: []float64{1, 0}},
+		{ID: "b", Embedding: []float64{0.99, 0.1}},
+		{ID: "c", Embedding: []float64{0, 1}},
+	}
+
+	tests := []struct {
+		name   string
+		k      int
+		lambda float64
+		want   []string
+	}{
+		{"relevance only", 2, 1, []string{"a", "b"}},
+		{"diversity skips near duplicates", 2, 0.3, []string{"a", "c"}},
+		{"zero k keeps every item", 0, 1, []string{"a", "b", "c"}},
+		{"k larger than the items keeps every item", 5, 1, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := itemIDs(MaximalMarginalRelevance(query, items, tt.k, tt.lambda))
+			if !equalStrings(got, tt.want) {
+				t.Errorf("MaximalMarginalRelevance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{"same direction", []float64{1, 2}, []float64{2, 4}, 1},
+		{"orthogonal", []float64{1, 0}, []float64{0, 1}, 0},
+		{"opposite", []float64{1, 0}, []float64{-1, 0}, -1},
+		{"different lengths", []float64{1, 0}, []float64{1}, 0},
+		{"zero vector", []float64{0, 0}, []float64{1, 0}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CosineSimilarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("CosineSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
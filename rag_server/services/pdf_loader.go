@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ledongthuc/pdf"
+	"rag_server/models"
+)
+
+// PDFLoader extracts the text of each page of a PDF
+type PDFLoader struct{}
+
+func (PDFLoader) Load(data []byte, filename string) (chunks []models.DocumentChunk, err error) {
+	// The PDF parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			chunks, err = nil, fmt.Errorf("Failed to read PDF %s: %v", filename, r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read PDF %s: %v", filename, err)
+	}
+
+	pages := reader.NumPage()
+	for number := 1; number <= pages; number++ {
+		page := reader.Page(number)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to extract page %d of %s: %v", number, filename, err)
+		}
+
+		for _, chunk := range SplitText(text, defaultChunkSize, defaultChunkOverlap) {
+			chunks = append(chunks, models.DocumentChunk{
+				Text:     chunk,
+				Metadata: map[string]interface{}{"page": number, "pages": pages},
+			})
+		}
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag_server/models"
+	"sort"
+	"strings"
+)
+
+const defaultQueryVariants = 3
+
+const rewritePrompt = `
+	Rewrite the question into a precise search query for a knowledge base of personal notes and course material.
+	Make implicit subjects explicit and keep the language of the question. Return only the query.
+`
+
+const expandPrompt = `
+	Write %d different paraphrases of the question to search a knowledge base of personal notes and course material.
+	Vary the vocabulary and keep the language of the question.
+	Return a JSON object {"queries": ["..."]}.
+`
+
+const hydePrompt = `
+	Write a short passage, as it could appear in personal notes or course material, that answers the question.
+	Keep the language of the question. Invent plausible details if needed. Return only the passage.
+`
+
+// retrievalQuery is a single search of the vector store: Text feeds the full-text query
+// and Embed is the text whose embedding feeds the vector query
+type retrievalQuery struct {
+	Text  string
+	Embed string
+}
+
+// PlanQueries applies the pre-retrieval strategy ("rewrite", "multi_query" or "hyde")
+// to the question and returns the searches to run
+func PlanQueries(chat *ChatClient, question, strategy string, variants int, model string, trace *models.Trace) ([]retrievalQuery, error) {
+	trace.Strategy = strategy
+
+	switch strategy {
+	case "":
+		return []retrievalQuery{{Text: question, Embed: question}}, nil
+
+	case "rewrite":
+		rewritten, err := RewriteQuery(chat, question, model)
+		if err != nil {
+			return nil, err
+		}
+		return []retrievalQuery{{Text: rewritten, Embed: rewritten}}, nil
+
+	case "multi_query":
+		paraphrases, err := ExpandQuery(chat, question, model, variants)
+		if err != nil {
+			return nil, err
+		}
+
+		queries := []retrievalQuery{{Text: question, Embed: question}}
+		for _, paraphrase := range paraphrases {
+			queries = append(queries, retrievalQuery{Text: paraphrase, Embed: paraphrase})
+		}
+		return queries, nil
+
+	case "hyde":
+		passage, err := HypotheticalAnswer(chat, question, model)
+		if err != nil {
+			return nil, err
+		}
+		trace.HypotheticalAnswer = passage
+		return []retrievalQuery{{Text: question, Embed: passage}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown query strategy %q", strategy)
+}
+
+// RewriteQuery asks the chat model for a clearer search query
+func RewriteQuery(chat *ChatClient, question, model string) (string, error) {
+	rewritten, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: rewritePrompt},
+			{Role: "user", Content: question},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to rewrite query: %v", err)
+	}
+
+	return strings.TrimSpace(rewritten), nil
+}
+
+// ExpandQuery asks the chat model for n paraphrases of the question
+func ExpandQuery(chat *ChatClient, question, model string, n int) ([]string, error) {
+	if n <= 0 {
+		n = defaultQueryVariants
+	}
+
+	content, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: fmt.Sprintf(expandPrompt, n)},
+			{Role: "user", Content: question},
+		},
+		ResponseFormat: &models.ResponseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to expand query: %v", err)
+	}
+
+	var expansion struct {
+		Queries []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(content), &expansion); err != nil {
+		return nil, fmt.Errorf("Failed to decode expanded queries: %v", err)
+	}
+
+	var queries []string
+	for _, query := range expansion.Queries {
+		if query = strings.TrimSpace(query); query != "" && len(queries) < n {
+			queries = append(queries, query)
+		}
+	}
+
+	return queries, nil
+}
+
+// HypotheticalAnswer asks the chat model for a passage answering the question (HyDE)
+func HypotheticalAnswer(chat *ChatClient, question, model string) (string, error) {
+	passage, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: hydePrompt},
+			{Role: "user", Content: question},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to generate hypothetical answer: %v", err)
+	}
+
+	return strings.TrimSpace(passage), nil
+}
+
+// mergeContextItems unions result lists, keeping the best score of duplicated items
+func mergeContextItems(lists [][]models.ContextItem, limit int) []models.ContextItem {
+	if len(lists) == 1 {
+		return lists[0]
+	}
+
+	byID := make(map[string]int)
+	var merged []models.ContextItem
+	for _, items := range lists {
+		for _, item := range items {
+			if i, ok := byID[item.ID]; ok {
+				if item.Score > merged[i].Score {
+					merged[i].Score = item.Score
+				}
+				continue
+			}
+			byID[item.ID] = len(merged)
+			merged = append(merged, item)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	if limit > 0 && len(merged) > limit {
+		merged = merged[:limit]
+	}
+
+	return merged
+}
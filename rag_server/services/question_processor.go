@@ -1,59 +1,347 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log"
+	"rag_server/cache"
+	"rag_server/graph"
+	"rag_server/graph_builder"
 	"rag_server/models"
 )
 
-// ProcessQuestion processes a single question using embeddings and chat
-func ProcessQuestion(db *sql.DB, question, prompt, embeddingModel, chatModel string) models.RagResponseItem {
-	// Step 1: Generate embedding for the question
-	embedding, err := GetEmbedding(question, embeddingModel)
+const notEnoughInformation = "The database does not contain enough information to answer the question."
+
+// StreamFunc receives the events of a streamed question in order
+type StreamFunc func(event models.StreamEvent)
+
+// questionState is the state carried through the question graph
+type questionState struct {
+	Question string
+	Query    string
+	History  []graph.Message
+
+	// Embedding is the embedding of the standalone question, used for MMR relevance
+	Embedding []float64
+	Items     []models.ContextItem
+
+	Response models.RagResponseItem
+	Trace    *models.Trace
+}
+
+// String keeps graph logs short, the state holds full documents
+func (s questionState) String() string {
+	return fmt.Sprintf("{query: %q, items: %d}", s.Query, len(s.Items))
+}
+
+// ProcessQuestion processes a single question using embeddings and chat.
+// history holds the prior conversation turns, if any.
+func ProcessQuestion(clients *Clients, db *sql.DB, store cache.Cache, question string, history []graph.Message, req models.RagRequest) models.RagResponseItem {
+	return processQuestion(context.Background(), clients, db, store, question, history, req, nil)
+}
+
+// StreamQuestion processes a single question like ProcessQuestion, emitting the retrieved
+// sources and the answer token deltas as soon as they are available. Cancelling ctx stops the answer stream.
+func StreamQuestion(ctx context.Context, clients *Clients, db *sql.DB, store cache.Cache, question string, history []graph.Message, req models.RagRequest, emit StreamFunc) models.RagResponseItem {
+	return processQuestion(ctx, clients, db, store, question, history, req, emit)
+}
+
+// processQuestion answers the question from the semantic cache when enabled, or else through the graph
+func processQuestion(ctx context.Context, clients *Clients, db *sql.DB, store cache.Cache, question string, history []graph.Message, req models.RagRequest, emit StreamFunc) models.RagResponseItem {
+	// Answers depend on the conversation, so only standalone questions use the semantic cache
+	var cacheEmbedding []float64
+	if req.SemanticCache && len(history) == 0 {
+		var cached *models.RagResponseItem
+		cached, cacheEmbedding = cachedAnswer(clients, db, question, req)
+		if cached != nil {
+			if emit != nil {
+				emit(models.StreamEvent{Type: "sources", Question: question, Sources: cached.Sources})
+				emit(models.StreamEvent{Type: "delta", Content: cached.Answer})
+			}
+			return *cached
+		}
+	}
+
+	response := answerQuestion(ctx, clients, db, store, question, history, req, emit)
+
+	if cacheEmbedding != nil && len(response.Sources) > 0 {
+		if err := StoreAnswer(db, cacheEmbedding, req, response, clients.AnswersTTL); err != nil {
+			log.Printf("Failed to cache answer of '%s': %v", question, err)
+		}
+	}
+
+	return response
+}
+
+// cachedAnswer looks the question up in the semantic cache, returning its embedding to store the new answer on a miss
+func cachedAnswer(clients *Clients, db *sql.DB, question string, req models.RagRequest) (*models.RagResponseItem, []float64) {
+	embedding, err := clients.Embedder.EmbedText(question, req.Embedding)
+	if err != nil {
+		log.Printf("Failed to embed '%s' for the answer cache: %v", question, err)
+		return nil, nil
+	}
+
+	cached, err := LookupAnswer(db, embedding, req, clients.AnswersTTL)
 	if err != nil {
-		logMessage := fmt.Sprintf("Failed to generate embedding for question '%s': %v", question, err)
-		return models.RagResponseItem{
-			Question: question,
-			Answer:   logMessage,
+		log.Printf("Failed to look up the answer cache: %v", err)
+		return nil, embedding
+	}
+	if cached == nil {
+		return nil, embedding
+	}
+
+	cached.Question = question
+	cached.Prompt = req.Template.ID()
+	cached.Trace = debugTrace(req, &models.Trace{Queries: []string{}, Path: []string{"semantic_cache"}})
+	return cached, nil
+}
+
+// answerQuestion runs the question through the graph
+//
+//	retrieve -> grade -> generate -> END
+//	              \-> web_search -> generate
+//
+// where web_search is only taken when the request enables the web fallback
+// and the grader finds no relevant item in the document store
+func answerQuestion(ctx context.Context, clients *Clients, db *sql.DB, store cache.Cache, question string, history []graph.Message, req models.RagRequest, emit StreamFunc) models.RagResponseItem {
+	gb := graph_builder.NewStateGraph[questionState]()
+
+	gb.AddNode("retrieve", func(state questionState, config context.Context) (questionState, error) {
+		return retrieveContext(clients, db, state, req)
+	})
+	gb.AddNode("grade", func(state questionState, config context.Context) (questionState, error) {
+		return gradeContext(clients, state, req)
+	})
+	gb.AddNode("web_search", func(state questionState, config context.Context) (questionState, error) {
+		return searchWebContext(clients, store, state, req)
+	})
+	gb.AddNode("generate", func(state questionState, config context.Context) (questionState, error) {
+		return generateAnswer(config, clients, state, req, emit)
+	})
+
+	gb.SetEntryPoint("retrieve")
+	gb.AddEdge("retrieve", "grade")
+	gb.AddConditionalEdge("grade", func(state questionState, config context.Context) (string, error) {
+		if len(state.Items) == 0 && req.WebFallback {
+			return "web_search", nil
 		}
+		return "generate", nil
+	})
+	gb.AddEdge("web_search", "generate")
+	gb.AddEdge("generate", graph.END)
+
+	g, err := gb.Compile()
+	if err != nil {
+		return failedResponse(question, fmt.Sprintf("Failed to build question graph: %v", err))
+	}
+
+	input := questionState{
+		Question: question,
+		History:  history,
+		Trace:    &models.Trace{},
+	}
+
+	states, err := g.Stream(input, ctx)
+	final := states[len(states)-1].State
+	for _, step := range states[1:] {
+		final.Trace.Path = append(final.Trace.Path, step.Node)
+	}
+
+	if err != nil {
+		response := failedResponse(question, fmt.Sprintf("Failed to answer question '%s': %v", question, err))
+		response.Trace = debugTrace(req, final.Trace)
+		return response
+	}
+
+	response := final.Response
+	response.Trace = debugTrace(req, final.Trace)
+	if final.Query != question {
+		response.StandaloneQuestion = final.Query
+	}
+
+	return response
+}
+
+// retrieveContext condenses the question, searches the document store and narrows the candidates down
+func retrieveContext(clients *Clients, db *sql.DB, state questionState, req models.RagRequest) (questionState, error) {
+	// Step 0: Condense a follow-up into a standalone query using the conversation within its token budget
+	state.History = TrimHistory(state.History, req.Model, req.HistoryTokens)
+	query, err := CondenseQuestion(clients.Chat, state.History, state.Question, req.Model)
+	if err != nil {
+		return state, err
 	}
+	state.Query = query
 
-	// Step 2: Query the database for related documents
-	contextItems, err := SearchItems(db, embedding)
+	// Step 1: Plan the searches to run, rewriting or expanding the question when requested
+	queries, err := PlanQueries(clients.Chat, query, req.QueryStrategy, req.QueryVariants, req.Model, state.Trace)
 	if err != nil {
-		logMessage := fmt.Sprintf("Failed to fetch context items for question '%s': %v", question, err)
-		return models.RagResponseItem{
-			Question: question,
-			Answer:   logMessage,
+		return state, err
+	}
+
+	// Step 2: Query the database for related documents, over-fetching when a later stage selects among them
+	retrieval := req.RetrievalOptions
+	retrieval.Limit = req.TopK
+	if req.Reranker != "" || req.MMR {
+		retrieval.Limit = req.Candidates
+	}
+	retrieval.WithEmbeddings = req.MMR
+
+	// MMR measures relevance to the question itself, which rewrite and hyde searches do not embed
+	texts := make([]string, len(queries), len(queries)+1)
+	for i, search := range queries {
+		texts[i] = search.Embed
+	}
+	if req.MMR && texts[0] != query {
+		texts = append(texts, query)
+	}
+	embeddings, err := clients.Embedder.Embed(texts, req.Embedding)
+	if err != nil {
+		return state, fmt.Errorf("Failed to generate embedding: %v", err)
+	}
+	if req.MMR {
+		state.Embedding = embeddings[0]
+		if texts[0] != query {
+			state.Embedding = embeddings[len(queries)]
+		}
+	}
+
+	var results [][]models.ContextItem
+	for i, search := range queries {
+		state.Trace.Queries = append(state.Trace.Queries, search.Text)
+
+		items, err := SearchItems(db, search.Text, embeddings[i], retrieval)
+		if err != nil {
+			return state, fmt.Errorf("Failed to fetch context items: %v", err)
 		}
+		results = append(results, items)
 	}
 
-	if len(contextItems) == 0 {
-		return models.RagResponseItem{
-			Question: question,
-			Answer:   "The database does not contain enough information to answer the question.",
+	state.Items = mergeContextItems(results, retrieval.Limit)
+	state.Trace.Retrieved = len(state.Items)
+
+	if len(state.Items) == 0 {
+		return state, nil
+	}
+
+	// Step 3: Diversify candidates, then rerank them and keep the best ones.
+	// When both are enabled, MMR picks the final items and the reranker only orders them.
+	if req.MMR {
+		lambda := defaultMMRLambda
+		if req.MMRLambda != nil {
+			lambda = *req.MMRLambda
+		}
+		state.Items = MaximalMarginalRelevance(state.Embedding, state.Items, req.TopK, lambda)
+	}
+
+	if req.Reranker != "" {
+		reranker, err := clients.Reranker(req.Reranker, req.Model)
+		if err != nil {
+			return state, err
 		}
+		if state.Items, err = reranker.Rerank(query, state.Items, req.TopK); err != nil {
+			return state, fmt.Errorf("Failed to rerank context items: %v", err)
+		}
+	}
+
+	return state, nil
+}
+
+// gradeContext drops irrelevant items when the web fallback may replace them
+func gradeContext(clients *Clients, state questionState, req models.RagRequest) (questionState, error) {
+	if !req.WebFallback {
+		return state, nil
+	}
+
+	relevant, err := GradeContext(clients.Chat, state.Query, state.Items, req.Model)
+	if err != nil {
+		return state, err
 	}
 
-	// Step 3: Prepare context for the question
-	var context []string
-	for _, item := range contextItems {
-		context = append(context, fmt.Sprintf("Text: %s\nMetadata: %s", item.Text, item.Metadata))
+	count := len(relevant)
+	state.Items = relevant
+	state.Trace.Relevant = &count
+
+	return state, nil
+}
+
+// searchWebContext replaces the document store context with chunks of crawled web pages
+func searchWebContext(clients *Clients, store cache.Cache, state questionState, req models.RagRequest) (questionState, error) {
+	provider, err := clients.SearchProvider(req.WebProvider)
+	if err != nil {
+		return state, err
 	}
 
-	// Step 4: Generate an answer using the context and OpenAI API
-	answer, err := GenerateAnswer(question, context, prompt, chatModel)
+	items, err := WebContext(clients, store, provider, state.Query, req.WebResults, req.TopK)
 	if err != nil {
-		logMessage := fmt.Sprintf("Failed to generate answer for question '%s': %v", question, err)
-		return models.RagResponseItem{
-			Question: question,
-			Answer:   logMessage,
+		return state, fmt.Errorf("Failed to search the web: %v", err)
+	}
+
+	state.Items = items
+	return state, nil
+}
+
+// generateAnswer writes the cited answer from the context items
+func generateAnswer(ctx context.Context, clients *Clients, state questionState, req models.RagRequest, emit StreamFunc) (questionState, error) {
+	if len(state.Items) == 0 {
+		state.Response = models.RagResponseItem{
+			Question: state.Question,
+			Answer:   notEnoughInformation,
 		}
+		return state, nil
+	}
+
+	// Step 4: Prepare numbered sources for the question and fit them into the token budget
+	sources := BuildSources(state.Items)
+	vars := answerVariables(state.Query, sources, state.Items, state.History, req.AnswerLanguage)
+	vars, usage, err := FitContext(clients.Chat, req.Template, vars, req.Model, req.ContextOptions)
+	state.Trace.Context = usage
+	if err != nil {
+		return state, err
+	}
+	sources = fittedSources(sources, vars.Context)
+
+	// Step 5: Generate an answer using the context and OpenAI API
+	var answer string
+	var truncated bool
+	if emit != nil {
+		emit(models.StreamEvent{Type: "sources", Question: state.Question, Sources: sources})
+		answer, truncated, err = GenerateAnswerStream(ctx, clients.Chat, req.Template, vars, req.Model, req.AnswerTokens, func(delta string) {
+			emit(models.StreamEvent{Type: "delta", Content: delta})
+		})
+	} else {
+		answer, truncated, err = GenerateAnswer(clients.Chat, req.Template, vars, req.Model, req.AnswerTokens)
+	}
+	if err != nil {
+		return state, fmt.Errorf("Failed to generate answer: %v", err)
+	}
+
+	// Step 6: Map citation markers to sources
+	answer, sources = AnnotateCitations(answer, sources)
+	state.Response = models.RagResponseItem{
+		Question:  state.Question,
+		Answer:    answer,
+		Sources:   sources,
+		Prompt:    req.Template.ID(),
+		Truncated: truncated,
 	}
 
-	// Step 5: Return the final response
+	return state, nil
+}
+
+// failedResponse reports the error of a question, keeping it in the answer for clients reading only that
+func failedResponse(question, message string) models.RagResponseItem {
 	return models.RagResponseItem{
 		Question: question,
-		Answer:   answer,
+		Answer:   message,
+		Error:    message,
+	}
+}
+
+// debugTrace returns the trace only when the request asked for it
+func debugTrace(req models.RagRequest, trace *models.Trace) *models.Trace {
+	if !req.Debug {
+		return nil
 	}
+	return trace
 }
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter enforces requests-per-minute and tokens-per-minute limits with two token buckets
+type rateLimiter struct {
+	mu sync.Mutex
+
+	requestsPerMinute float64
+	tokensPerMinute   float64
+
+	requests  float64
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newRateLimiter(requestsPerMinute, tokensPerMinute int) *rateLimiter {
+	return &rateLimiter{
+		requestsPerMinute: float64(requestsPerMinute),
+		tokensPerMinute:   float64(tokensPerMinute),
+		requests:          float64(requestsPerMinute),
+		tokens:            float64(tokensPerMinute),
+		updatedAt:         time.Now(),
+	}
+}
+
+// wait blocks until a request of the given number of tokens fits in both limits, then books it
+func (l *rateLimiter) wait(tokens int) {
+	needed := float64(tokens)
+	if needed > l.tokensPerMinute {
+		needed = l.tokensPerMinute
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		elapsed := now.Sub(l.updatedAt).Minutes()
+		l.requests = min(l.requestsPerMinute, l.requests+elapsed*l.requestsPerMinute)
+		l.tokens = min(l.tokensPerMinute, l.tokens+elapsed*l.tokensPerMinute)
+		l.updatedAt = now
+
+		if l.requests >= 1 && l.tokens >= needed {
+			l.requests--
+			l.tokens -= needed
+			l.mu.Unlock()
+			return
+		}
+
+		// Sleep until the scarcest bucket holds enough
+		delay := 0.0
+		if l.requests < 1 {
+			delay = (1 - l.requests) / l.requestsPerMinute
+		}
+		if l.tokens < needed {
+			delay = max(delay, (needed-l.tokens)/l.tokensPerMinute)
+		}
+		l.mu.Unlock()
+
+		time.Sleep(time.Duration(delay*float64(time.Minute)) + time.Millisecond)
+	}
+}
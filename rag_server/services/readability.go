@@ -0,0 +1,258 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	htmltomarkdown "github.com/JohannesKaufmann/html-to-markdown/v2"
+	"golang.org/x/net/html"
+	"net/url"
+	"rag_server/models"
+	"regexp"
+	"strings"
+)
+
+// Readability heuristics, adapted from Mozilla's Readability
+var (
+	// clutterTags never hold the main content. Forms may, ASP.NET WebForms wrapping the whole body in one,
+	// so they are only removed from within the chosen content.
+	clutterTags = map[string]bool{
+		"script": true, "style": true, "noscript": true, "iframe": true, "svg": true, "canvas": true,
+		"button": true, "input": true, "select": true, "textarea": true, "template": true,
+		"nav": true, "header": true, "footer": true, "aside": true, "dialog": true,
+	}
+
+	// clutterRoles are the ARIA landmarks around the main content
+	clutterRoles = map[string]bool{
+		"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+		"dialog": true, "alertdialog": true, "search": true, "menu": true, "menubar": true,
+	}
+
+	unlikelyCandidates = regexp.MustCompile(`(?i)cookie|consent|gdpr|banner|footer|header|navbar|\bnav\b|menu|sidebar|comment|share|social|related|advert|\bads?\b|promo|newsletter|subscribe|popup|modal|breadcrumb|pagination|skip-link`)
+	maybeCandidates    = regexp.MustCompile(`(?i)article|content|main|body|post|entry|story|text`)
+
+	// scoredTags are the blocks whose text is credited to their ancestors
+	scoredTags = map[string]bool{"p": true, "pre": true, "td": true, "blockquote": true, "li": true}
+)
+
+// ExtractArticle isolates the main content of an HTML page, returns it as markdown
+// and collects the title, byline, publish date and canonical URL of the page
+func ExtractArticle(rawHTML, pageURL string) (*models.WebPage, error) {
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML of %s: %v", pageURL, err)
+	}
+
+	page := extractMetadata(doc, pageURL)
+
+	removeClutter(doc)
+	content := mainContent(doc)
+	for _, form := range findAll(content, func(n *html.Node) bool { return n.Data == "form" }) {
+		if form != content && form.Parent != nil {
+			form.Parent.RemoveChild(form)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, content); err != nil {
+		return nil, fmt.Errorf("error rendering content of %s: %v", pageURL, err)
+	}
+
+	markdown, err := htmltomarkdown.ConvertString(buf.String())
+	if err != nil {
+		return nil, fmt.Errorf("error converting %s to markdown: %v", pageURL, err)
+	}
+	page.Markdown = strings.TrimSpace(markdown)
+
+	return page, nil
+}
+
+// extractMetadata reads the page metadata from meta tags, falling back to the markup
+func extractMetadata(doc *html.Node, pageURL string) *models.WebPage {
+	metas := make(map[string]string)
+	for _, meta := range findAll(doc, func(n *html.Node) bool { return n.Data == "meta" }) {
+		key := strings.ToLower(firstNonEmpty(attr(meta, "property"), attr(meta, "name"), attr(meta, "itemprop")))
+		if content := strings.TrimSpace(attr(meta, "content")); key != "" && content != "" {
+			if _, exists := metas[key]; !exists {
+				metas[key] = content
+			}
+		}
+	}
+
+	page := &models.WebPage{
+		URL:         pageURL,
+		Title:       firstNonEmpty(metas["og:title"], metas["twitter:title"]),
+		Byline:      firstNonEmpty(metas["author"], metas["article:author"], metas["byl"]),
+		PublishedAt: firstNonEmpty(metas["article:published_time"], metas["datepublished"], metas["date"], metas["pubdate"], metas["publishdate"], metas["dc.date"]),
+		SiteName:    metas["og:site_name"],
+	}
+
+	if page.Title == "" {
+		if titles := findAll(doc, func(n *html.Node) bool { return n.Data == "title" }); len(titles) > 0 {
+			page.Title = textContent(titles[0])
+		}
+	}
+	if page.Title == "" {
+		if headings := findAll(doc, func(n *html.Node) bool { return n.Data == "h1" }); len(headings) > 0 {
+			page.Title = textContent(headings[0])
+		}
+	}
+
+	if page.Byline == "" {
+		bylines := findAll(doc, func(n *html.Node) bool {
+			return attr(n, "rel") == "author" || attr(n, "itemprop") == "author" || hasClass(n, "byline") || hasClass(n, "author")
+		})
+		if len(bylines) > 0 {
+			page.Byline = textContent(bylines[0])
+		}
+	}
+
+	if page.PublishedAt == "" {
+		if times := findAll(doc, func(n *html.Node) bool { return n.Data == "time" && attr(n, "datetime") != "" }); len(times) > 0 {
+			page.PublishedAt = attr(times[0], "datetime")
+		}
+	}
+
+	canonical := metas["og:url"]
+	for _, link := range findAll(doc, func(n *html.Node) bool { return n.Data == "link" }) {
+		if strings.EqualFold(attr(link, "rel"), "canonical") && attr(link, "href") != "" {
+			canonical = attr(link, "href")
+			break
+		}
+	}
+	page.CanonicalURL = resolveURL(pageURL, canonical)
+
+	return page
+}
+
+// removeClutter detaches navigation, banners, scripts and other elements around the main content
+func removeClutter(doc *html.Node) {
+	clutter := findAll(doc, func(n *html.Node) bool {
+		if n.Data == "html" || n.Data == "body" || n.Data == "article" || n.Data == "main" {
+			return false
+		}
+		// The header of the page is a banner, the header of an article holds its title and byline
+		if n.Data == "header" && insideContent(n) {
+			return false
+		}
+		if clutterTags[n.Data] || clutterRoles[attr(n, "role")] {
+			return true
+		}
+		if attr(n, "aria-hidden") == "true" || hasAttr(n, "hidden") {
+			return true
+		}
+
+		identity := attr(n, "class") + " " + attr(n, "id")
+		return unlikelyCandidates.MatchString(identity) && !maybeCandidates.MatchString(identity)
+	})
+
+	for _, n := range clutter {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+}
+
+// mainContent returns the element holding the article: the largest <article>, the <main>
+// landmark, or else the block whose paragraphs score the most
+func mainContent(doc *html.Node) *html.Node {
+	var best *html.Node
+	bestLength := 0
+	for _, article := range findAll(doc, func(n *html.Node) bool { return n.Data == "article" }) {
+		if length := len(textContent(article)); length > bestLength {
+			best, bestLength = article, length
+		}
+	}
+	if best != nil && bestLength > 200 {
+		return best
+	}
+	// A short article is a teaser or a card, let the other heuristics find the content
+	best = nil
+
+	if mains := findAll(doc, func(n *html.Node) bool { return n.Data == "main" || attr(n, "role") == "main" }); len(mains) > 0 {
+		return mains[0]
+	}
+
+	scores := make(map[*html.Node]float64)
+	for _, block := range findAll(doc, func(n *html.Node) bool { return scoredTags[n.Data] }) {
+		text := textContent(block)
+		if len(text) < 25 {
+			continue
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + float64(min(len(text)/100, 3))
+		if parent := block.Parent; parent != nil {
+			scores[parent] += score
+			if grandParent := parent.Parent; grandParent != nil {
+				scores[grandParent] += score / 2
+			}
+		}
+	}
+
+	bestScore := 0.0
+	for candidate, score := range scores {
+		score *= 1 - linkDensity(candidate)
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	if bodies := findAll(doc, func(n *html.Node) bool { return n.Data == "body" }); len(bodies) > 0 {
+		return bodies[0]
+	}
+	return doc
+}
+
+// insideContent reports whether n is within an <article> or <main> element
+func insideContent(n *html.Node) bool {
+	for parent := n.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == html.ElementNode && (parent.Data == "article" || parent.Data == "main" || attr(parent, "role") == "main") {
+			return true
+		}
+	}
+	return false
+}
+
+// linkDensity is the share of the text of n found inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(textContent(n))
+	if total == 0 {
+		return 0
+	}
+
+	linked := 0
+	for _, anchor := range findAll(n, func(n *html.Node) bool { return n.Data == "a" }) {
+		linked += len(textContent(anchor))
+	}
+
+	return float64(linked) / float64(total)
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveURL resolves ref against base, returning base when ref is empty or invalid
+func resolveURL(base, ref string) string {
+	if ref == "" {
+		return base
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return base
+	}
+
+	return baseURL.ResolveReference(refURL).String()
+}
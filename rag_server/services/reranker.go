@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"math"
+	"net/http"
+	"rag_server/config"
+	"rag_server/models"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// rerankClient is shared by the cross-encoder rerankers
+var rerankClient = &http.Client{Timeout: 15 * time.Second}
+
+// Reranker reorders retrieved context items by relevance to the question and keeps the best topK
+type Reranker interface {
+	Rerank(question string, items []models.ContextItem, topK int) ([]models.ContextItem, error)
+}
+
+// NewReranker returns the reranker registered under name, the LLM reranker grading with the chat model
+func NewReranker(cfg config.RerankerConfig, chat *ChatClient, name, model string) (Reranker, error) {
+	switch name {
+	case "llm":
+		return &LLMReranker{Chat: chat, Model: model}, nil
+	case "cross-encoder":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("RERANKER_URL is not set")
+		}
+		return &CrossEncoderReranker{Endpoint: cfg.URL}, nil
+	case "lexical":
+		return &LexicalReranker{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown reranker %q", name)
+}
+
+// LLMReranker asks the chat model to grade every passage on a 0-10 scale
+type LLMReranker struct {
+	Chat  *ChatClient
+	Model string
+}
+
+const llmRerankPrompt = `
+	You grade how relevant passages are to a question.
+	Return a JSON object {"scores": [{"index": <passage index>, "score": <0-10>}]} with one entry per passage.
+	10 means the passage directly answers the question, 0 means it is unrelated.
+`
+
+// maxRerankPassageLength truncates passages sent to the LLM reranker, in characters
+const maxRerankPassageLength = 1500
+
+func (r *LLMReranker) Rerank(question string, items []models.ContextItem, topK int) ([]models.ContextItem, error) {
+	var passages strings.Builder
+	for i, item := range items {
+		fmt.Fprintf(&passages, "[%d] %s\n\n", i, truncateRunes(item.Text, maxRerankPassageLength))
+	}
+
+	temperature := 0.0
+	content, err := r.Chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: r.Model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: llmRerankPrompt},
+			{Role: "user", Content: fmt.Sprintf("Question: %s\n\nPassages:\n%s", question, passages.String())},
+		},
+		Temperature:    &temperature,
+		ResponseFormat: &models.ResponseFormat{Type: "json_object"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to score passages: %v", err)
+	}
+
+	var grades struct {
+		Scores []struct {
+			Index int     `json:"index"`
+			Score float64 `json:"score"`
+		} `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(content), &grades); err != nil {
+		return nil, fmt.Errorf("Failed to decode passage scores: %v", err)
+	}
+
+	scored := make([]models.ContextItem, len(items))
+	copy(scored, items)
+	for i := range scored {
+		scored[i].Score = 0
+	}
+	for _, grade := range grades.Scores {
+		if grade.Index >= 0 && grade.Index < len(scored) {
+			scored[grade.Index].Score = grade.Score / 10
+		}
+	}
+
+	return keepTopK(scored, topK), nil
+}
+
+// CrossEncoderReranker scores passages with a cross-encoder served over HTTP.
+// The endpoint follows the text-embeddings-inference /rerank contract.
+type CrossEncoderReranker struct {
+	Endpoint string
+}
+
+func (r *CrossEncoderReranker) Rerank(question string, items []models.ContextItem, topK int) ([]models.ContextItem, error) {
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = item.Text
+	}
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"query":    question,
+		"texts":    texts,
+		"truncate": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal rerank request: %v", err)
+	}
+
+	resp, err := rerankClient.Post(r.Endpoint, "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to execute rerank request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body := new(bytes.Buffer)
+		body.ReadFrom(resp.Body)
+		return nil, fmt.Errorf("Rerank request failed: %s", body.String())
+	}
+
+	var results []struct {
+		Index int     `json:"index"`
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("Failed to decode rerank response: %v", err)
+	}
+
+	scored := make([]models.ContextItem, len(items))
+	copy(scored, items)
+	for _, result := range results {
+		if result.Index >= 0 && result.Index < len(scored) {
+			scored[result.Index].Score = result.Score
+		}
+	}
+
+	return keepTopK(scored, topK), nil
+}
+
+// LexicalReranker scores passages by term overlap with the question.
+// It needs no network access and serves as a baseline for offline tests.
+type LexicalReranker struct{}
+
+func (r *LexicalReranker) Rerank(question string, items []models.ContextItem, topK int) ([]models.ContextItem, error) {
+	questionTerms := tokenize(question)
+
+	scored := make([]models.ContextItem, len(items))
+	copy(scored, items)
+	for i := range scored {
+		scored[i].Score = lexicalOverlap(questionTerms, tokenize(scored[i].Text))
+	}
+
+	return keepTopK(scored, topK), nil
+}
+
+// lexicalOverlap returns the share of question terms found in the passage, damped by term frequency
+func lexicalOverlap(questionTerms, passageTerms []string) float64 {
+	if len(questionTerms) == 0 {
+		return 0
+	}
+
+	frequencies := make(map[string]int)
+	for _, term := range passageTerms {
+		frequencies[term]++
+	}
+
+	var score float64
+	seen := make(map[string]bool)
+	for _, term := range questionTerms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		if count := frequencies[term]; count > 0 {
+			score += 1 + math.Log(float64(count))
+		}
+	}
+
+	return score / float64(len(seen))
+}
+
+// tokenize lowercases text, removes accents and splits it into terms of at least 3 characters
+func tokenize(text string) []string {
+	t := transform.Chain(norm.NFD, transform.RemoveFunc(isNonSpacingMark), norm.NFC)
+	normalized, _, _ := transform.String(t, strings.ToLower(text))
+
+	fields := strings.FieldsFunc(normalized, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, field := range fields {
+		if len([]rune(field)) >= 3 {
+			terms = append(terms, field)
+		}
+	}
+
+	return terms
+}
+
+// truncateRunes cuts text down to at most limit characters, without splitting a multi-byte character
+func truncateRunes(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+
+	count := 0
+	for i := range text {
+		if count == limit {
+			return text[:i]
+		}
+		count++
+	}
+	return text
+}
+
+// keepTopK sorts items by descending score and truncates them to topK
+func keepTopK(items []models.ContextItem, topK int) []models.ContextItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Score > items[j].Score
+	})
+
+	if topK > 0 && len(items) > topK {
+		items = items[:topK]
+	}
+
+	return items
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"rag_server/models"
+	"testing"
+)
+
+func TestLexicalReranker(t *testing.T) {
+	items := []models.ContextItem{
+		{ID: "a", Text: "Le chat noir dort"},
+		{ID: "b", Text: "Un chien blanc"},
+		{ID: "c", Text: "chat et chat"},
+		{ID: "d", Text: "Cours d'ÉTÉ"},
+	}
+
+	tests := []struct {
+		name     string
+		question string
+		topK     int
+		want     []string
+	}{
+		{"ranks by term overlap", "chat noir", 3, []string{"a", "c", "b"}},
+		{"keeps top k", "chat noir", 1, []string{"a"}},
+		{"keeps every item without top k", "chat noir", 0, []string{"a", "c", "b", "d"}},
+		{"ignores case and accents", "ete", 1, []string{"d"}},
+		{"keeps the order of unmatched items", "tortue", 4, []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, err := (&LexicalReranker{}).Rerank(tt.question, items, tt.topK)
+			if err != nil {
+				t.Fatalf("Rerank() error = %v", err)
+			}
+			if got := itemIDs(ranked); !equalStrings(got, tt.want) {
+				t.Errorf("Rerank() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"abcdef", 3, "abc"},
+		{"été à la mer", 4, "été "},
+		{"日本語のテキスト", 3, "日本語"},
+		{"", 3, ""},
+	}
+
+	for _, tt := range tests {
+		if got := truncateRunes(tt.text, tt.limit); got != tt.want {
+			t.Errorf("truncateRunes(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func itemIDs(items []models.ContextItem) []string {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"rag_server/models"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultRelevanceThreshold = 0.5
+
+	// relevanceBatchSize is the number of results scored per chat request
+	relevanceBatchSize = 10
+)
+
+const relevancePrompt = `
+	You score how relevant web search results are to a question, from their title and snippet.
+	Give every result a score between 0 (unrelated) and 1 (answers the question) and a short reason.
+`
+
+// relevanceSchema is the structured output of a relevance batch
+var relevanceSchema = &models.ResponseFormat{
+	Type: "json_schema",
+	JSONSchema: &models.JSONSchema{
+		Name:   "search_result_relevance",
+		Strict: true,
+		Schema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"results": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"index":  map[string]interface{}{"type": "integer"},
+							"score":  map[string]interface{}{"type": "number"},
+							"reason": map[string]interface{}{"type": "string"},
+						},
+						"required":             []string{"index", "score", "reason"},
+						"additionalProperties": false,
+					},
+				},
+			},
+			"required":             []string{"results"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// FilterResults scores every result against the question with the chat model, in batches,
+// and keeps the results scoring at least threshold along with their score and reason
+func FilterResults(chat *ChatClient, question string, results []models.SearchResult, model string, threshold float64) ([]models.SearchResult, error) {
+	scored := make([]models.SearchResult, len(results))
+	copy(scored, results)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(results)/relevanceBatchSize+1)
+
+	for start := 0; start < len(scored); start += relevanceBatchSize {
+		end := start + relevanceBatchSize
+		if end > len(scored) {
+			end = len(scored)
+		}
+
+		wg.Add(1)
+		go func(batch []models.SearchResult) {
+			defer wg.Done()
+			if err := scoreBatch(chat, question, batch, model); err != nil {
+				errs <- err
+			}
+		}(scored[start:end])
+	}
+
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	kept := []models.SearchResult{}
+	for _, result := range scored {
+		if result.Relevance != nil && *result.Relevance >= threshold {
+			kept = append(kept, result)
+		}
+	}
+
+	return kept, nil
+}
+
+// scoreBatch sets Relevance and Reason on every result of the batch
+func scoreBatch(chat *ChatClient, question string, batch []models.SearchResult, model string) error {
+	var listing strings.Builder
+	for i, result := range batch {
+		fmt.Fprintf(&listing, "[%d] %s\n%s\n\n", i, result.Title, firstNonEmpty(result.Snippet, result.Description))
+	}
+
+	temperature := 0.0
+	content, err := chat.ChatCompletion(models.OpenAIChatRequest{
+		Model: model,
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: relevancePrompt},
+			{Role: "user", Content: fmt.Sprintf("Question: %s\n\nResults:\n%s", question, listing.String())},
+		},
+		Temperature:    &temperature,
+		ResponseFormat: relevanceSchema,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to score search results: %v", err)
+	}
+
+	var grades struct {
+		Results []struct {
+			Index  int     `json:"index"`
+			Score  float64 `json:"score"`
+			Reason string  `json:"reason"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(content), &grades); err != nil {
+		return fmt.Errorf("Failed to decode search result scores: %v", err)
+	}
+
+	for _, grade := range grades.Results {
+		if grade.Index < 0 || grade.Index >= len(batch) {
+			continue
+		}
+		score := grade.Score
+		batch[grade.Index].Relevance = &score
+		batch[grade.Index].Reason = grade.Reason
+	}
+
+	return nil
+}
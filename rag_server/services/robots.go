@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsTTL is how long a robots.txt stays cached
+const robotsTTL = 24 * time.Hour
+
+// robotsRules are the rules of robots.txt applying to the crawler user agent
+type robotsRules struct {
+	rules       []robotsRule
+	crawlDelay  time.Duration
+	disallowAll bool
+	fetchedAt   time.Time
+}
+
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// robotsFor returns the cached rules of the host, fetching robots.txt when needed
+func (c *Crawler) robotsFor(target *url.URL) (*robotsRules, error) {
+	c.mu.Lock()
+	rules, ok := c.robots[target.Host]
+	c.mu.Unlock()
+	if ok && time.Since(rules.fetchedAt) < robotsTTL {
+		return rules, nil
+	}
+
+	rules, err := c.fetchRobots(target)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.robots[target.Host] = rules
+	c.mu.Unlock()
+
+	return rules, nil
+}
+
+// fetchRobots downloads and parses robots.txt following RFC 9309: a missing file allows
+// everything while an unreachable one disallows everything. It only fails when the host
+// is too busy to be queried, which says nothing about its rules.
+func (c *Crawler) fetchRobots(target *url.URL) (*robotsRules, error) {
+	robotsURL := &url.URL{Scheme: target.Scheme, Host: target.Host, Path: "/robots.txt"}
+
+	resp, err := c.get(robotsURL, nil)
+	var delayed *CrawlDelayError
+	if errors.As(err, &delayed) {
+		return nil, err
+	}
+	if err != nil {
+		return &robotsRules{disallowAll: true, fetchedAt: time.Now()}, nil
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return &robotsRules{disallowAll: true, fetchedAt: time.Now()}, nil
+	case resp.StatusCode >= 400:
+		return &robotsRules{fetchedAt: time.Now()}, nil
+	}
+
+	rules := parseRobots(io.LimitReader(resp.Body, 512<<10), c.options.UserAgent)
+	rules.fetchedAt = time.Now()
+	return rules, nil
+}
+
+// parseRobots keeps the group of the most specific matching user agent, falling back to "*"
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	product := strings.ToLower(strings.SplitN(userAgent, "/", 2)[0])
+
+	var specific, wildcard *robotsRules
+	var current []*robotsRules
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the same group
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			} else if strings.Contains(product, agent) {
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+
+		case "allow", "disallow":
+			inAgents = false
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{
+				allow:   key == "allow",
+				length:  len(value),
+				pattern: robotsPattern(value),
+			}
+			for _, group := range current {
+				group.rules = append(group.rules, rule)
+			}
+
+		case "crawl-delay":
+			inAgents = false
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				for _, group := range current {
+					group.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	if wildcard != nil {
+		return wildcard
+	}
+	return &robotsRules{}
+}
+
+// robotsPattern compiles a robots.txt path pattern supporting the * and $ wildcards
+func robotsPattern(value string) *regexp.Regexp {
+	anchored := strings.HasSuffix(value, "$")
+	value = strings.TrimSuffix(value, "$")
+
+	expression := "^" + strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*")
+	if anchored {
+		expression += "$"
+	}
+
+	return regexp.MustCompile(expression)
+}
+
+// allowed applies the longest matching rule, allow rules winning ties
+func (r *robotsRules) allowed(target *url.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+
+	allow, longest := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > longest || (rule.length == longest && rule.allow) {
+			allow, longest = rule.allow, rule.length
+		}
+	}
+
+	return allow
+}
@@ -4,44 +4,217 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"math"
 	"rag_server/models"
+	"sort"
 	"strconv"
+	"strings"
+)
+
+const (
+	defaultSearchLimit = 10
+
+	// defaultLanguage is also the text search configuration of the n8n_vectors_text_search_idx index
+	defaultLanguage = "french"
+
+	// rrfK dampens the weight of top ranks in Reciprocal Rank Fusion
+	rrfK = 60
 )
 
 // SearchItems récupère les documents similaires à partir de la base de données
-func SearchItems(db *sql.DB, embedding []float64) ([]models.ContextItem, error) {
-	const query = `
-		SELECT text, metadata
+func SearchItems(db *sql.DB, question string, embedding []float64, options models.RetrievalOptions) ([]models.ContextItem, error) {
+	limit := options.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	vectorItems, err := searchVector(db, embedding, limit, options.WithEmbeddings)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.SearchMode != "hybrid" {
+		return vectorItems, nil
+	}
+
+	language := options.Language
+	if language == "" {
+		language = defaultLanguage
+	}
+
+	textItems, err := searchFullText(db, question, language, limit, options.WithEmbeddings)
+	if err != nil {
+		return nil, err
+	}
+
+	return fuseResults(vectorItems, textItems, options, limit), nil
+}
+
+// searchVector ranks documents by cosine distance to the embedding
+func searchVector(db *sql.DB, embedding []float64, limit int, withEmbeddings bool) ([]models.ContextItem, error) {
+	query := fmt.Sprintf(`
+		SELECT id::text, text, metadata, 1 - (embedding <=> $1) AS score, %s
 		FROM n8n_vectors
 		ORDER BY embedding <=> $1
-		LIMIT 10;
-	`
+		LIMIT $2;
+	`, embeddingColumn(withEmbeddings))
 
-	rows, err := db.Query(query, ToVectorString(embedding))
+	rows, err := db.Query(query, ToVectorString(embedding), limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %v", err)
 	}
 	defer rows.Close()
 
+	return scanContextItems(rows)
+}
+
+// searchFullText ranks documents with a language-aware tsvector query
+func searchFullText(db *sql.DB, question, language string, limit int, withEmbeddings bool) ([]models.ContextItem, error) {
+	query := fmt.Sprintf(`
+		SELECT id::text, text, metadata,
+			ts_rank_cd(to_tsvector($1::regconfig, text), websearch_to_tsquery($1::regconfig, $2)) AS score, %s
+		FROM n8n_vectors
+		WHERE to_tsvector($1::regconfig, text) @@ websearch_to_tsquery($1::regconfig, $2)
+		ORDER BY score DESC
+		LIMIT $3;
+	`, embeddingColumn(withEmbeddings))
+
+	rows, err := db.Query(query, language, question, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute full-text query: %v", err)
+	}
+	defer rows.Close()
+
+	return scanContextItems(rows)
+}
+
+// embeddingColumn selects the embedding as text only when it is needed, to keep rows small otherwise
+func embeddingColumn(withEmbeddings bool) string {
+	if withEmbeddings {
+		return "embedding::text"
+	}
+	return "NULL::text"
+}
+
+// scanContextItems reads the rows of a search, failing on the first row that cannot be read
+func scanContextItems(rows *sql.Rows) ([]models.ContextItem, error) {
 	var contextItems []models.ContextItem
 	for rows.Next() {
-		var text string
+		var id, text string
 		var metadataRaw json.RawMessage
-		if err := rows.Scan(&text, &metadataRaw); err != nil {
-			log.Printf("Failed to scan row: %v", err)
-			continue
+		var score float64
+		var embeddingRaw sql.NullString
+		if err := rows.Scan(&id, &text, &metadataRaw, &score, &embeddingRaw); err != nil {
+			return nil, fmt.Errorf("Failed to scan row: %v", err)
 		}
 
-		contextItems = append(contextItems, models.ContextItem{
+		item := models.ContextItem{
+			ID:       id,
 			Text:     text,
 			Metadata: metadataRaw,
-		})
+			Score:    score,
+		}
+
+		if embeddingRaw.Valid {
+			embedding, err := ParseVectorString(embeddingRaw.String)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse embedding of item %s: %v", id, err)
+			}
+			item.Embedding = embedding
+		}
+
+		contextItems = append(contextItems, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read rows: %v", err)
 	}
 
 	return contextItems, nil
 }
 
+// fuseResults merges vector and full-text results into a single ranking
+func fuseResults(vectorItems, textItems []models.ContextItem, options models.RetrievalOptions, limit int) []models.ContextItem {
+	vectorWeight, textWeight := options.VectorWeight, options.TextWeight
+	if vectorWeight == 0 && textWeight == 0 {
+		vectorWeight, textWeight = 1, 1
+	}
+
+	var vectorScores, textScores []float64
+	if options.Fusion == "weighted" {
+		vectorScores = normalizeScores(vectorItems)
+		textScores = normalizeScores(textItems)
+	} else {
+		vectorScores = reciprocalRanks(len(vectorItems))
+		textScores = reciprocalRanks(len(textItems))
+	}
+
+	fused := make(map[string]*models.ContextItem)
+	var order []string
+	accumulate := func(items []models.ContextItem, scores []float64, weight float64) {
+		for i, item := range items {
+			existing, ok := fused[item.ID]
+			if !ok {
+				item.Score = 0
+				existing = &item
+				fused[item.ID] = existing
+				order = append(order, item.ID)
+			}
+			existing.Score += weight * scores[i]
+		}
+	}
+	accumulate(vectorItems, vectorScores, vectorWeight)
+	accumulate(textItems, textScores, textWeight)
+
+	results := make([]models.ContextItem, 0, len(order))
+	for _, id := range order {
+		results = append(results, *fused[id])
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
+
+// reciprocalRanks returns the RRF contribution of each rank position
+func reciprocalRanks(n int) []float64 {
+	scores := make([]float64, n)
+	for rank := range scores {
+		scores[rank] = 1 / float64(rrfK+rank+1)
+	}
+	return scores
+}
+
+// normalizeScores min-max scales the item scores into [0, 1]
+func normalizeScores(items []models.ContextItem) []float64 {
+	scores := make([]float64, len(items))
+	if len(items) == 0 {
+		return scores
+	}
+
+	minScore, maxScore := math.Inf(1), math.Inf(-1)
+	for _, item := range items {
+		minScore = math.Min(minScore, item.Score)
+		maxScore = math.Max(maxScore, item.Score)
+	}
+
+	for i, item := range items {
+		if maxScore == minScore {
+			scores[i] = 1
+			continue
+		}
+		scores[i] = (item.Score - minScore) / (maxScore - minScore)
+	}
+
+	return scores
+}
+
 // ToVectorString converts a slice of floats into a PostgreSQL-compatible vector string
 func ToVectorString(data []float64) string {
 	buf := make([]byte, 0, 2+16*len(data))
@@ -57,3 +230,28 @@ func ToVectorString(data []float64) string {
 	buf = append(buf, ']')
 	return string(buf)
 }
+
+// ParseVectorString converts a PostgreSQL vector string such as "[0.1,0.2]" into a slice of floats
+func ParseVectorString(value string) ([]float64, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '[' || value[len(value)-1] != ']' {
+		return nil, fmt.Errorf("invalid vector %q", value)
+	}
+
+	value = value[1 : len(value)-1]
+	if value == "" {
+		return []float64{}, nil
+	}
+
+	parts := strings.Split(value, ",")
+	data := make([]float64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector component %q: %v", part, err)
+		}
+		data[i] = number
+	}
+
+	return data, nil
+}
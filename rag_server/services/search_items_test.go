@@ -0,0 +1,43 @@
+package services
+
+import (
+	"rag_server/models"
+	"testing"
+)
+
+func TestFuseResults(t *testing.T) {
+	vectorItems := []models.ContextItem{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.5}}
+	textItems := []models.ContextItem{{ID: "b", Score: 3}, {ID: "c", Score: 1}}
+
+	tests := []struct {
+		name    string
+		options models.RetrievalOptions
+		limit   int
+		want    []string
+	}{
+		{"rrf favours items found by both searches", models.RetrievalOptions{Fusion: "rrf"}, 3, []string{"b", "a", "c"}},
+		{"rrf is the default fusion", models.RetrievalOptions{}, 3, []string{"b", "a", "c"}},
+		{"limit keeps the best items", models.RetrievalOptions{}, 2, []string{"b", "a"}},
+		{"zero text weight ranks by vector only", models.RetrievalOptions{VectorWeight: 1}, 3, []string{"a", "b", "c"}},
+		{"weighted sums normalised scores", models.RetrievalOptions{Fusion: "weighted", VectorWeight: 1, TextWeight: 2}, 3, []string{"b", "a", "c"}},
+		{"weighted follows the heavier list", models.RetrievalOptions{Fusion: "weighted", VectorWeight: 3, TextWeight: 1}, 3, []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := itemIDs(fuseResults(vectorItems, textItems, tt.options, tt.limit))
+			if !equalStrings(got, tt.want) {
+				t.Errorf("fuseResults() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFuseResultsKeepsInputScores(t *testing.T) {
+	vectorItems := []models.ContextItem{{ID: "a", Score: 0.9}}
+	fuseResults(vectorItems, nil, models.RetrievalOptions{}, 1)
+
+	if vectorItems[0].Score != 0.9 {
+		t.Errorf("fuseResults() changed the input score to %v", vectorItems[0].Score)
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"rag_server/models"
+	"strconv"
+	"strings"
+)
+
+const defaultSearchResults = 10
+
+// resultCount returns the number of results requested, bounded by the provider maximum
+func resultCount(opts models.SearchOptions, max int) int {
+	count := opts.Num
+	if count <= 0 {
+		count = defaultSearchResults
+	}
+	if count > max {
+		count = max
+	}
+	return count
+}
+
+// resultOffset returns the 0-based index of the first requested result
+func resultOffset(opts models.SearchOptions) int {
+	if opts.Start > 0 {
+		return opts.Start - 1
+	}
+	if opts.Page > 1 {
+		return (opts.Page - 1) * resultCount(opts, 100)
+	}
+	return 0
+}
+
+// languageCode turns "lang_fr" into "fr"
+func languageCode(opts models.SearchOptions) string {
+	return strings.ToLower(strings.TrimPrefix(opts.Language, "lang_"))
+}
+
+// locale returns a "fr-FR" style locale from the language and country options
+func locale(opts models.SearchOptions) string {
+	language, country := languageCode(opts), strings.ToUpper(opts.Country)
+	switch {
+	case language != "" && country != "":
+		return language + "-" + country
+	case language != "":
+		return language + "-" + strings.ToUpper(language)
+	case country != "":
+		return strings.ToLower(country) + "-" + country
+	}
+	return ""
+}
+
+// datePeriod splits a Google dateRestrict value such as "m6" into its unit and count
+func datePeriod(opts models.SearchOptions) (unit byte, count int) {
+	if opts.DateRestrict == "" {
+		return 0, 0
+	}
+
+	unit = opts.DateRestrict[0]
+	count, err := strconv.Atoi(opts.DateRestrict[1:])
+	if err != nil || count <= 0 {
+		count = 1
+	}
+	return unit, count
+}
+
+// datePeriodUnits are the periods of the providers filtering on a single day, week, month or year.
+// Google alone accepts a number of periods such as "m6".
+var datePeriodUnits = map[string]string{
+	"searxng":    "dwmy",
+	"brave":      "dwmy",
+	"duckduckgo": "dwmy",
+	"bing":       "dwm",
+}
+
+// ValidateDateRestrict rejects the date restrictions the provider cannot express
+func ValidateDateRestrict(provider string, opts models.SearchOptions) error {
+	units, ok := datePeriodUnits[provider]
+	unit, count := datePeriod(opts)
+	if !ok || unit == 0 {
+		return nil
+	}
+
+	if count != 1 || !strings.ContainsRune(units, rune(unit)) {
+		accepted := make([]string, len(units))
+		for i := range units {
+			accepted[i] = units[i:i+1] + "1"
+		}
+		return fmt.Errorf("date_restrict %q is not supported by %s, use one of %s", opts.DateRestrict, provider, strings.Join(accepted, ", "))
+	}
+	return nil
+}
+
+// withSite prepends a site: operator for providers without a site parameter
+func withSite(query string, opts models.SearchOptions) string {
+	if opts.SiteSearch == "" {
+		return query
+	}
+	return "site:" + opts.SiteSearch + " " + query
+}
+
+// optionsCacheKey encodes the options canonically, empty options give an empty key
+func optionsCacheKey(opts models.SearchOptions) string {
+	params := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	if opts.Num > 0 {
+		set("num", strconv.Itoa(opts.Num))
+	}
+	if offset := resultOffset(opts); offset > 0 {
+		set("offset", strconv.Itoa(offset))
+	}
+	set("lr", opts.Language)
+	set("gl", opts.Country)
+	set("dateRestrict", opts.DateRestrict)
+	set("siteSearch", opts.SiteSearch)
+	set("safe", opts.SafeSearch)
+
+	return params.Encode()
+}
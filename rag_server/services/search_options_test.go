@@ -0,0 +1,33 @@
+package services
+
+import (
+	"rag_server/models"
+	"testing"
+)
+
+func TestValidateDateRestrict(t *testing.T) {
+	tests := []struct {
+		provider     string
+		dateRestrict string
+		wantErr      bool
+	}{
+		{"google", "m6", false},
+		{"google", "y2", false},
+		{"searxng", "", false},
+		{"searxng", "w1", false},
+		{"searxng", "w", false},
+		{"searxng", "m6", true},
+		{"brave", "y1", false},
+		{"brave", "d3", true},
+		{"duckduckgo", "d1", false},
+		{"bing", "m1", false},
+		{"bing", "y1", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateDateRestrict(tt.provider, models.SearchOptions{DateRestrict: tt.dateRestrict})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateDateRestrict(%q, %q) error = %v, want error %v", tt.provider, tt.dateRestrict, err, tt.wantErr)
+		}
+	}
+}
@@ -1,88 +1,80 @@
 package services
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/redis/go-redis/v9"
-	"net/http"
+	"log"
+	"rag_server/cache"
 	"rag_server/models"
-	"strings"
-	"time"
 )
 
-// ProcessSearch processes a single question using embeddings and chat
-func ProcessSearch(rdb *redis.Client, ctx context.Context, query string) models.SearchResponse {
-	cacheKey := fmt.Sprintf("GoogleSearchCached:%s", query)
+const defaultSearchPassages = 8
 
-	// Step 1: Check if the result is already in cache
-	cachedData, err := rdb.Get(ctx, cacheKey).Result()
-	if err == nil && cachedData != "" {
-		// If cache hit, unmarshal and return
-		var cachedResults []models.GoogleSearchResult
-		if err := json.Unmarshal([]byte(cachedData), &cachedResults); err == nil {
-			fmt.Println("Cache hit: Returning cached results")
-			return models.SearchResponse{
-				Question: query,
-				Links:    cachedResults,
-			}
-		}
+// ProcessSearch searches the web for the query and, when requested, writes a cited answer from the result pages
+func ProcessSearch(clients *Clients, store cache.Cache, provider SearchProvider, query string, req models.SearchRequest) models.SearchResponse {
+	links := SearchWebCached(store, provider, query, req.SearchOptions, clients.SearchTTL)
+	if links == nil {
+		links = []models.SearchResult{}
 	}
 
-	// Step 2: If not cached, perform the actual Google search
-	results := searchGoogle(query)
-	if results == nil {
-		fmt.Println("No results found from Google API")
-		return models.SearchResponse{
-			Question: query,
-			Links:    []models.GoogleSearchResult{},
-		}
+	response := models.SearchResponse{
+		Question: query,
 	}
 
-	// Step 3: Store the result in cache for future use
-	jsonData, err := json.Marshal(results)
-	if err == nil {
-		err = rdb.Set(ctx, cacheKey, jsonData, 24*time.Hour).Err() // Cache for 24 hours
+	// Unfiltered results are still returned when the filter fails
+	if req.Filter {
+		threshold := defaultRelevanceThreshold
+		if req.Threshold != nil {
+			threshold = *req.Threshold
+		}
+
+		filtered, err := FilterResults(clients.Chat, query, links, req.Model, threshold)
 		if err != nil {
-			fmt.Println("Error caching results:", err)
+			log.Printf("Failed to filter results of '%s': %v", query, err)
+			response.Error = fmt.Sprintf("Failed to filter results for question '%s': %v", query, err)
+		} else {
+			links = filtered
 		}
 	}
+	response.Links = links
 
-	return models.SearchResponse{
-		Question: query,
-		Links:    results,
+	if !req.Answer || len(links) == 0 {
+		return response
 	}
-}
 
-func chatGPTCheck(prompt, apiKey, model string) bool {
-	payload := map[string]interface{}{
-		"model":      model,
-		"prompt":     prompt,
-		"max_tokens": 5,
+	// Step 4: Crawl the top results and extract the passages relevant to the question
+	passages := req.Passages
+	if passages <= 0 {
+		passages = defaultSearchPassages
 	}
-	body, _ := json.Marshal(payload)
-
-	req, _ := http.NewRequest("POST", "https://api.openai.com/v1/completions", bytes.NewBuffer(body))
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	items, err := CrawlContext(clients.Crawler, query, links, req.CrawlLimit, passages)
 	if err != nil {
-		fmt.Println("Error calling OpenAI API:", err)
-		return false
+		response.Error = fmt.Sprintf("Failed to crawl search results for question '%s': %v", query, err)
+		return response
+	}
+	if len(items) == 0 {
+		response.Answer = "The search results do not contain enough information to answer the question."
+		return response
 	}
-	defer resp.Body.Close()
 
-	var result struct {
-		Choices []struct {
-			Text string `json:"text"`
-		} `json:"choices"`
+	// Step 5: Have the model write a cited answer from the passages fitting the token budget
+	sources := BuildSources(items)
+	vars := answerVariables(query, sources, items, nil, req.AnswerLanguage)
+	vars, _, err = FitContext(clients.Chat, req.Template, vars, req.Model, req.ContextOptions)
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to build context for question '%s': %v", query, err)
+		return response
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		fmt.Println("Error decoding OpenAI API response:", err)
-		return false
+	sources = fittedSources(sources, vars.Context)
+
+	answer, truncated, err := GenerateAnswer(clients.Chat, req.Template, vars, req.Model, req.AnswerTokens)
+	if err != nil {
+		response.Error = fmt.Sprintf("Failed to generate answer for question '%s': %v", query, err)
+		return response
 	}
 
-	return strings.Contains(result.Choices[0].Text, "Yes")
+	response.Answer, response.Sources = AnnotateCitations(answer, sources)
+	response.Truncated = truncated
+	response.Prompt = req.Template.ID()
+	return response
 }
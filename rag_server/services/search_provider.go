@@ -0,0 +1,114 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"rag_server/cache"
+	"rag_server/config"
+	"rag_server/models"
+	"time"
+)
+
+// searchClient is shared by all search providers
+var searchClient = &http.Client{Timeout: 15 * time.Second}
+
+// SearchProvider is a web search backend returning normalised results
+type SearchProvider interface {
+	Name() string
+	Search(query string, opts models.SearchOptions) ([]models.SearchResult, error)
+}
+
+// NewSearchProvider returns the provider registered under name,
+// or the configured one when name is empty
+func NewSearchProvider(cfg config.SearchConfig, name string) (SearchProvider, error) {
+	if name == "" {
+		name = cfg.Provider
+	}
+
+	switch name {
+	case "google":
+		return &GoogleProvider{
+			APIKey: cfg.GoogleAPIKey,
+			CseID:  cfg.CseID,
+		}, nil
+	case "searxng":
+		if cfg.SearxngURL == "" {
+			return nil, fmt.Errorf("SEARXNG_URL is not set")
+		}
+		return &SearxngProvider{BaseURL: cfg.SearxngURL}, nil
+	case "brave":
+		return &BraveProvider{APIKey: cfg.BraveAPIKey}, nil
+	case "bing":
+		return &BingProvider{APIKey: cfg.BingAPIKey}, nil
+	case "duckduckgo":
+		return &DuckDuckGoProvider{}, nil
+	}
+
+	return nil, fmt.Errorf("unknown search provider %q", name)
+}
+
+// searchCacheKey namespaces cached results by provider and search options
+func searchCacheKey(provider SearchProvider, query string, opts models.SearchOptions) string {
+	key := fmt.Sprintf("SearchCached:%s:%s", provider.Name(), query)
+	if options := optionsCacheKey(opts); options != "" {
+		key += "|" + options
+	}
+	return key
+}
+
+// SearchWebCached searches the web with the provider, reusing the results cached for the same query
+// and options. New results are cached for ttl.
+func SearchWebCached(store cache.Cache, provider SearchProvider, query string, opts models.SearchOptions, ttl time.Duration) []models.SearchResult {
+	cacheKey := searchCacheKey(provider, query, opts)
+
+	// Step 1: Check if the result is already in cache
+	if cachedData, found, err := store.Get(cacheKey); err == nil && found {
+		var cachedResults []models.SearchResult
+		if err := json.Unmarshal(cachedData, &cachedResults); err == nil {
+			return cachedResults
+		}
+	}
+
+	// Step 2: If not cached, perform the actual search
+	results, err := provider.Search(query, opts)
+	if err != nil {
+		log.Printf("Error during %s search: %v", provider.Name(), err)
+		return nil
+	}
+	if results == nil {
+		log.Printf("No results found from %s", provider.Name())
+		return nil
+	}
+
+	// Step 3: Store the result in cache for future use
+	if jsonData, err := json.Marshal(results); err == nil {
+		if err := store.Set(cacheKey, jsonData, ttl); err != nil {
+			log.Printf("Error caching results: %v", err)
+		}
+	}
+
+	return results
+}
+
+// getSearchJSON performs a search API call and decodes its JSON response into target
+func getSearchJSON(req *http.Request, target interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := searchClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to execute search request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Search request failed with status %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return fmt.Errorf("Failed to decode search response: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"rag_server/models"
+	"strconv"
+	"strings"
+)
+
+// SearxngProvider searches a self-hosted SearXNG instance through its JSON API.
+// The json format must be enabled in the instance settings.
+type SearxngProvider struct {
+	BaseURL string
+}
+
+func (p *SearxngProvider) Name() string {
+	return "searxng"
+}
+
+// maxSearxngPages bounds the pages fetched for a single search
+const maxSearxngPages = 10
+
+// Search fetches as many pages as needed to gather the requested number of results
+func (p *SearxngProvider) Search(query string, opts models.SearchOptions) ([]models.SearchResult, error) {
+	if err := ValidateDateRestrict(p.Name(), opts); err != nil {
+		return nil, err
+	}
+
+	// SearXNG pages hold about 10 results, the first page and the results to skip are picked from the offset
+	count := resultCount(opts, 100)
+	offset := resultOffset(opts)
+	page := offset/defaultSearchResults + 1
+	skip := offset % defaultSearchResults
+
+	params := url.Values{}
+	params.Set("q", withSite(query, opts))
+	params.Set("format", "json")
+	if language := languageCode(opts); language != "" {
+		params.Set("language", language)
+	}
+	if unit, _ := datePeriod(opts); unit != 0 {
+		params.Set("time_range", map[byte]string{'d': "day", 'w': "week", 'm': "month", 'y': "year"}[unit])
+	}
+	switch opts.SafeSearch {
+	case "active":
+		params.Set("safesearch", "2")
+	case "off":
+		params.Set("safesearch", "0")
+	}
+
+	// Engines may return a result on several pages, keep its first occurrence
+	seen := make(map[string]bool)
+	var links []models.SearchResult
+	for fetched := 0; len(links) < count && fetched < maxSearxngPages; fetched++ {
+		results, err := p.searchPage(params, page+fetched)
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			break
+		}
+
+		for _, result := range results {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(links) == count || seen[result.Url] {
+				continue
+			}
+			seen[result.Url] = true
+			links = append(links, result)
+		}
+	}
+
+	return links, nil
+}
+
+func (p *SearxngProvider) searchPage(params url.Values, page int) ([]models.SearchResult, error) {
+	params.Set("pageno", strconv.Itoa(page))
+
+	req, err := http.NewRequest("GET", strings.TrimRight(p.BaseURL, "/")+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create search request: %v", err)
+	}
+
+	var result struct {
+		Results []struct {
+			Title     string `json:"title"`
+			URL       string `json:"url"`
+			Content   string `json:"content"`
+			ImgSrc    string `json:"img_src"`
+			Thumbnail string `json:"thumbnail"`
+		} `json:"results"`
+	}
+	if err := getSearchJSON(req, &result); err != nil {
+		return nil, err
+	}
+
+	var links []models.SearchResult
+	for _, item := range result.Results {
+		links = append(links, models.SearchResult{
+			Title:   item.Title,
+			Snippet: item.Content,
+			Url:     item.URL,
+			Image:   firstNonEmpty(item.ImgSrc, item.Thumbnail),
+		})
+	}
+
+	return links, nil
+}
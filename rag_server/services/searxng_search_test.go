@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"rag_server/models"
+	"testing"
+)
+
+// searxngServer serves numbered results from a fake SearXNG instance and records the queries it received
+func searxngServer(t *testing.T, perPage int) (*httptest.Server, *[]url.Values) {
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		queries = append(queries, query)
+
+		var page int
+		fmt.Sscan(query.Get("pageno"), &page)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"results": [`)
+		for i := 0; i < perPage; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			n := (page-1)*perPage + i + 1
+			fmt.Fprintf(w, `{"title": "Result %d", "url": "https://example.com/%d", "content": "Snippet %d", "thumbnail": "https://example.com/%d.png"}`, n, n, n, n)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queries
+}
+
+func TestSearxngProviderSearch(t *testing.T) {
+	server, queries := searxngServer(t, 10)
+	provider := &SearxngProvider{BaseURL: server.URL + "/"}
+
+	results, err := provider.Search("golang", models.SearchOptions{
+		Num:          3,
+		Language:     "lang_fr",
+		DateRestrict: "w1",
+		SiteSearch:   "go.dev",
+		SafeSearch:   "active",
+	})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+
+	if len(*queries) != 1 {
+		t.Fatalf("Search() sent %d requests, want 1", len(*queries))
+	}
+	want := map[string]string{
+		"q":          "site:go.dev golang",
+		"format":     "json",
+		"pageno":     "1",
+		"language":   "fr",
+		"time_range": "week",
+		"safesearch": "2",
+	}
+	for key, value := range want {
+		if got := (*queries)[0].Get(key); got != value {
+			t.Errorf("Search() sent %s = %q, want %q", key, got, value)
+		}
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("Search() returned %d results, want 3", len(results))
+	}
+	first := models.SearchResult{
+		Title:   "Result 1",
+		Snippet: "Snippet 1",
+		Url:     "https://example.com/1",
+		Image:   "https://example.com/1.png",
+	}
+	if results[0].Title != first.Title || results[0].Snippet != first.Snippet || results[0].Url != first.Url || results[0].Image != first.Image {
+		t.Errorf("Search() first result = %+v, want %+v", results[0], first)
+	}
+}
+
+func TestSearxngProviderSearchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "format not allowed", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	provider := &SearxngProvider{BaseURL: server.URL}
+	if _, err := provider.Search("golang", models.SearchOptions{}); err == nil {
+		t.Error("Search() error = nil, want an error for a forbidden format")
+	}
+}
+
+func TestSearxngProviderSearchPages(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      models.SearchOptions
+		wantPages []string
+		wantFirst string
+		wantCount int
+	}{
+		{"single page", models.SearchOptions{Num: 5}, []string{"1"}, "Result 1", 5},
+		{"several pages", models.SearchOptions{Num: 25}, []string{"1", "2", "3"}, "Result 1", 25},
+		{"offset within a page", models.SearchOptions{Start: 15, Num: 10}, []string{"2", "3"}, "Result 15", 10},
+		{"page option", models.SearchOptions{Page: 3, Num: 10}, []string{"3"}, "Result 21", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, queries := searxngServer(t, 10)
+			provider := &SearxngProvider{BaseURL: server.URL}
+
+			results, err := provider.Search("golang", tt.opts)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+
+			var pages []string
+			for _, query := range *queries {
+				pages = append(pages, query.Get("pageno"))
+			}
+			if !equalStrings(pages, tt.wantPages) {
+				t.Errorf("Search() fetched pages %v, want %v", pages, tt.wantPages)
+			}
+			if len(results) != tt.wantCount {
+				t.Fatalf("Search() returned %d results, want %d", len(results), tt.wantCount)
+			}
+			if results[0].Title != tt.wantFirst {
+				t.Errorf("Search() first result = %q, want %q", results[0].Title, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestSearxngProviderSearchStopsOnEmptyPage(t *testing.T) {
+	server, queries := searxngServer(t, 0)
+	provider := &SearxngProvider{BaseURL: server.URL}
+
+	results, err := provider.Search("golang", models.SearchOptions{Num: 30})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(results) != 0 || len(*queries) != 1 {
+		t.Errorf("Search() returned %d results in %d requests, want 0 in 1", len(results), len(*queries))
+	}
+}
+
+func TestSearxngProviderRejectsPeriodCounts(t *testing.T) {
+	server, queries := searxngServer(t, 10)
+	provider := &SearxngProvider{BaseURL: server.URL}
+
+	if _, err := provider.Search("golang", models.SearchOptions{DateRestrict: "m6"}); err == nil {
+		t.Error("Search() error = nil, want an error for m6")
+	}
+	if len(*queries) != 0 {
+		t.Errorf("Search() sent %d requests, want none", len(*queries))
+	}
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"log"
+	"net/url"
+	"rag_server/cache"
+	"rag_server/models"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCrawlDepth = 2
+	defaultCrawlPages = 100
+	crawlJobTTL       = 7 * 24 * time.Hour
+
+	// maxSitemaps bounds the sitemaps read through nested sitemap indexes
+	maxSitemaps = 50
+
+	// maxCrawlJobErrors bounds the errors kept in the job progress
+	maxCrawlJobErrors = 20
+)
+
+// skippedExtensions are links to files that are not web pages
+var skippedExtensions = regexp.MustCompile(`(?i)\.(pdf|zip|gz|tar|png|jpe?g|gif|svg|webp|ico|mp3|mp4|avi|mov|css|js|woff2?)$`)
+
+// crawlTarget is a page waiting in the crawl frontier
+type crawlTarget struct {
+	URL   string
+	Depth int
+}
+
+// sitemapDocument reads both <urlset> sitemaps and <sitemapindex> indexes
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+func crawlJobKey(id string) string {
+	return fmt.Sprintf("CrawlJob:%s", id)
+}
+
+// StartCrawlJob registers a crawl job in the cache and runs it in the background
+func StartCrawlJob(clients *Clients, db *sql.DB, store cache.Cache, req models.CrawlRequest) (*models.CrawlJob, error) {
+	if len(req.URLs) == 0 && len(req.Sitemaps) == 0 {
+		return nil, fmt.Errorf("At least one URL or sitemap is required")
+	}
+	if req.MaxDepth <= 0 {
+		req.MaxDepth = defaultCrawlDepth
+	}
+	if req.MaxPages <= 0 {
+		req.MaxPages = defaultCrawlPages
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("Failed to generate crawl job id: %v", err)
+	}
+
+	job := &models.CrawlJob{
+		ID:        hex.EncodeToString(id),
+		Status:    "running",
+		Request:   req,
+		StartedAt: time.Now(),
+	}
+	if err := saveCrawlJob(store, job); err != nil {
+		return nil, err
+	}
+
+	// The crawl goes on updating job, so callers get a copy of its starting state
+	snapshot := *job
+	go runCrawlJob(clients, db, store, job)
+
+	return &snapshot, nil
+}
+
+// GetCrawlJob returns the progress of a crawl job, or nil when it does not exist
+func GetCrawlJob(store cache.Cache, id string) (*models.CrawlJob, error) {
+	data, found, err := store.Get(crawlJobKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load crawl job: %v", err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var job models.CrawlJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("Failed to decode crawl job: %v", err)
+	}
+
+	return &job, nil
+}
+
+func saveCrawlJob(store cache.Cache, job *models.CrawlJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal crawl job: %v", err)
+	}
+
+	if err := store.Set(crawlJobKey(job.ID), data, crawlJobTTL); err != nil {
+		return fmt.Errorf("Failed to save crawl job: %v", err)
+	}
+
+	return nil
+}
+
+// runCrawlJob crawls the site breadth first from the seeds, following same-site links up to the
+// depth and page limits, and ingests each new page in the vector store
+func runCrawlJob(clients *Clients, db *sql.DB, store cache.Cache, job *models.CrawlJob) {
+	req := job.Request
+	interval, _ := time.ParseDuration(req.RefreshInterval)
+
+	sites := make(map[string]bool)
+	seen := make(map[string]bool)
+	var frontier []crawlTarget
+
+	enqueue := func(rawURL string, depth int) {
+		target, ok := normalizeCrawlURL(rawURL)
+		if !ok || seen[target] {
+			return
+		}
+		seen[target] = true
+		job.Discovered++
+		frontier = append(frontier, crawlTarget{URL: target, Depth: depth})
+	}
+
+	// sameSite keeps the crawl on the sites of the seeds and sitemaps
+	sameSite := func(rawURL string) bool {
+		parsed, err := url.Parse(rawURL)
+		return err == nil && sites[siteHost(parsed.Host)]
+	}
+
+	for _, seed := range req.URLs {
+		if parsed, err := url.Parse(seed); err == nil {
+			sites[siteHost(parsed.Host)] = true
+		}
+		enqueue(seed, 0)
+	}
+	for _, sitemap := range req.Sitemaps {
+		if parsed, err := url.Parse(sitemap); err == nil {
+			sites[siteHost(parsed.Host)] = true
+		}
+	}
+	for _, sitemap := range req.Sitemaps {
+		locations, err := readSitemap(clients.Crawler, sitemap)
+		if err != nil {
+			recordCrawlError(job, err)
+		}
+		for _, location := range locations {
+			if sameSite(location) {
+				enqueue(location, 0)
+			}
+		}
+	}
+
+	canonicals := make(map[string]bool)
+	hashes := make(map[string]bool)
+
+	for len(frontier) > 0 && job.Crawled+job.Skipped+job.Failed < req.MaxPages {
+		target := frontier[0]
+		frontier = frontier[1:]
+
+		page, err := clients.Crawler.FetchHTML(target.URL)
+		var disallowed *RobotsDisallowedError
+		var delayed *CrawlDelayError
+		var unsupported *UnsupportedContentTypeError
+		switch {
+		case errors.As(err, &disallowed), errors.As(err, &delayed), errors.As(err, &unsupported):
+			job.Skipped++
+			saveCrawlProgress(store, job)
+			continue
+		case err != nil:
+			job.Failed++
+			recordCrawlError(job, err)
+			saveCrawlProgress(store, job)
+			continue
+		}
+		// A redirect may leave the site, whose pages are not part of the crawl
+		if page.URL != target.URL && !sameSite(page.URL) {
+			job.Skipped++
+			saveCrawlProgress(store, job)
+			continue
+		}
+		job.Crawled++
+
+		if target.Depth < req.MaxDepth {
+			for _, link := range extractLinks(page.Body, page.URL) {
+				if sameSite(link) {
+					enqueue(link, target.Depth+1)
+				}
+			}
+		}
+
+		article, err := ExtractArticle(page.Body, page.URL)
+		if err != nil {
+			job.Failed++
+			recordCrawlError(job, err)
+			saveCrawlProgress(store, job)
+			continue
+		}
+
+		// A canonical link to another site cannot be trusted to name this page
+		if !sameSite(article.CanonicalURL) {
+			article.CanonicalURL = page.URL
+		}
+
+		// The same page is often reachable under several URLs, or mirrored under another path
+		hash := sha256.Sum256([]byte(article.Markdown))
+		contentHash := hex.EncodeToString(hash[:])
+		if canonicals[article.CanonicalURL] || hashes[contentHash] || article.Markdown == "" {
+			job.Duplicates++
+			saveCrawlProgress(store, job)
+			continue
+		}
+		canonicals[article.CanonicalURL] = true
+		hashes[contentHash] = true
+
+		chunks, changed, err := StoreWebPage(clients.Embedder, db, page, article, req.Embedding, interval)
+		switch {
+		case err != nil:
+			job.Failed++
+			recordCrawlError(job, err)
+		case changed:
+			job.Ingested++
+			job.Chunks += chunks
+		default:
+			job.Unchanged++
+		}
+
+		saveCrawlProgress(store, job)
+	}
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Status = "completed"
+	if job.Crawled == 0 && job.Failed > 0 {
+		job.Status = "failed"
+	}
+	saveCrawlProgress(store, job)
+}
+
+// saveCrawlProgress stores the job, logging failures so the crawl goes on
+func saveCrawlProgress(store cache.Cache, job *models.CrawlJob) {
+	if err := saveCrawlJob(store, job); err != nil {
+		log.Printf("Crawl job %s: %v", job.ID, err)
+	}
+}
+
+func recordCrawlError(job *models.CrawlJob, err error) {
+	log.Printf("Crawl job %s: %v", job.ID, err)
+	if len(job.Errors) < maxCrawlJobErrors {
+		job.Errors = append(job.Errors, err.Error())
+	}
+}
+
+// readSitemap returns the page URLs of a sitemap, following the sitemap indexes of the same site
+func readSitemap(crawler *Crawler, sitemapURL string) ([]string, error) {
+	root, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sitemap URL %q: %v", sitemapURL, err)
+	}
+
+	var locations []string
+	queue := []string{sitemapURL}
+
+	for read := 0; len(queue) > 0 && read < maxSitemaps; read++ {
+		current := queue[0]
+		queue = queue[1:]
+
+		page, err := crawler.Fetch(current)
+		if err != nil {
+			return locations, fmt.Errorf("Failed to fetch sitemap %s: %v", current, err)
+		}
+
+		body := []byte(page.Body)
+		if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+			reader, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				return locations, fmt.Errorf("Failed to decompress sitemap %s: %v", current, err)
+			}
+			// The body limit only bounds the compressed bytes, bound the decompressed ones too
+			limit := crawler.options.MaxBodySize
+			if body, err = io.ReadAll(io.LimitReader(reader, limit+1)); err != nil {
+				return locations, fmt.Errorf("Failed to decompress sitemap %s: %v", current, err)
+			}
+			if int64(len(body)) > limit {
+				return locations, &BodyTooLargeError{URL: current, Limit: limit}
+			}
+		}
+
+		var document sitemapDocument
+		if err := xml.Unmarshal(body, &document); err != nil {
+			return locations, fmt.Errorf("Failed to parse sitemap %s: %v", current, err)
+		}
+
+		for _, entry := range document.URLs {
+			locations = append(locations, strings.TrimSpace(entry.Loc))
+		}
+		for _, entry := range document.Sitemaps {
+			location := strings.TrimSpace(entry.Loc)
+			if parsed, err := url.Parse(location); err == nil && siteHost(parsed.Host) == siteHost(root.Host) {
+				queue = append(queue, location)
+			}
+		}
+	}
+
+	return locations, nil
+}
+
+// extractLinks returns the absolute URLs of the followable links of an HTML page
+func extractLinks(rawHTML, pageURL string) []string {
+	doc, err := html.Parse(strings.NewReader(rawHTML))
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	for _, anchor := range findAll(doc, func(n *html.Node) bool { return n.Data == "a" }) {
+		href := strings.TrimSpace(attr(anchor, "href"))
+		if href == "" || strings.HasPrefix(href, "#") || strings.Contains(attr(anchor, "rel"), "nofollow") {
+			continue
+		}
+		links = append(links, resolveURL(pageURL, href))
+	}
+
+	return links
+}
+
+// normalizeCrawlURL drops the fragment and lowercases the host so equivalent links are crawled once
+func normalizeCrawlURL(rawURL string) (string, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+	if skippedExtensions.MatchString(parsed.Path) {
+		return "", false
+	}
+
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.Host = strings.ToLower(parsed.Host)
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+
+	return parsed.String(), true
+}
+
+// siteHost identifies a site by its host, ignoring the www. prefix
+func siteHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
@@ -0,0 +1,16 @@
+package services
+
+import (
+	"rag_server/models"
+)
+
+// TextLoader splits plain text
+type TextLoader struct{}
+
+func (TextLoader) Load(data []byte, filename string) ([]models.DocumentChunk, error) {
+	var chunks []models.DocumentChunk
+	for _, text := range SplitText(string(data), defaultChunkSize, defaultChunkOverlap) {
+		chunks = append(chunks, models.DocumentChunk{Text: text, Metadata: map[string]interface{}{}})
+	}
+	return chunks, nil
+}
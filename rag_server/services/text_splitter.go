@@ -0,0 +1,103 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultChunkSize    = 1000
+	defaultChunkOverlap = 150
+)
+
+// chunkSeparators are tried in order, from paragraph breaks down to single spaces
+var chunkSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// SplitText cuts text into chunks of at most chunkSize characters, splitting on the coarsest
+// separator possible and repeating up to overlap characters between consecutive chunks
+func SplitText(text string, chunkSize, overlap int) []string {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	if overlap < 0 || overlap >= chunkSize {
+		overlap = 0
+	}
+
+	var chunks []string
+	var current []rune
+	// added is false while current only holds the overlap of the previous chunk
+	added := false
+
+	flush := func() {
+		if chunk := strings.TrimSpace(string(current)); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+
+		// Keep the last characters of the chunk as overlap for the next one
+		current = lastRunes(current, overlap)
+		added = false
+	}
+
+	for _, piece := range splitPieces(text, chunkSize, 0) {
+		pieceRunes := []rune(piece)
+		if len(current)+len(pieceRunes) > chunkSize && added {
+			flush()
+		}
+
+		// The overlap gives way to a piece that would not fit beside it
+		current = lastRunes(current, chunkSize-len(pieceRunes))
+		current = append(current, pieceRunes...)
+		added = true
+	}
+
+	if added {
+		flush()
+	}
+
+	return chunks
+}
+
+// splitPieces recursively splits text until every piece fits in chunkSize, keeping separators attached
+func splitPieces(text string, chunkSize, level int) []string {
+	if utf8.RuneCountInString(text) <= chunkSize {
+		return []string{text}
+	}
+
+	if level >= len(chunkSeparators) {
+		// No separator left, cut on character boundaries
+		var pieces []string
+		runes := []rune(text)
+		for start := 0; start < len(runes); start += chunkSize {
+			end := start + chunkSize
+			if end > len(runes) {
+				end = len(runes)
+			}
+			pieces = append(pieces, string(runes[start:end]))
+		}
+		return pieces
+	}
+
+	separator := chunkSeparators[level]
+	parts := strings.SplitAfter(text, separator)
+	if len(parts) == 1 {
+		return splitPieces(text, chunkSize, level+1)
+	}
+
+	var pieces []string
+	for _, part := range parts {
+		pieces = append(pieces, splitPieces(part, chunkSize, level+1)...)
+	}
+
+	return pieces
+}
+
+// lastRunes returns the last limit runes of text, or none when limit is not positive
+func lastRunes(text []rune, limit int) []rune {
+	if limit <= 0 {
+		return nil
+	}
+	if len(text) > limit {
+		text = text[len(text)-limit:]
+	}
+	return append([]rune(nil), text...)
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	words := strings.Repeat("mot ", 400)
+	var sentences strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&sentences, "%03d %s. ", i, strings.Repeat("x", 86))
+	}
+
+	tests := []struct {
+		name      string
+		text      string
+		chunkSize int
+		overlap   int
+		// overlapping is false when the pieces leave no room for the overlap
+		overlapping bool
+	}{
+		{"words", words, 100, 20, true},
+		{"pieces longer than the overlap", sentences.String(), 200, 50, true},
+		{"pieces filling the chunk", sentences.String(), 92, 50, false},
+		{"no overlap", words, 100, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitText(tt.text, tt.chunkSize, tt.overlap)
+			if len(chunks) < 2 {
+				t.Fatalf("SplitText() = %d chunks, want several", len(chunks))
+			}
+			for i, chunk := range chunks {
+				if length := utf8.RuneCountInString(chunk); length > tt.chunkSize {
+					t.Errorf("chunk %d has %d characters, want at most %d", i, length, tt.chunkSize)
+				}
+				if i == 0 || !tt.overlapping {
+					continue
+				}
+				previous := chunks[i-1]
+				head := chunk[:min(len(chunk), 10)]
+				if !strings.Contains(previous[len(previous)-min(len(previous), tt.overlap):], head) {
+					t.Errorf("chunk %d starts with %q, want it to overlap the previous chunk", i, head)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/pkoukk/tiktoken-go-loader"
+	"strings"
+	"sync"
+)
+
+// fallbackEncoding is used for models unknown to tiktoken, such as the o-series which share the gpt-4o encoding
+const fallbackEncoding = "o200k_base"
+
+// defaultContextWindow is assumed for models missing from contextWindows
+const defaultContextWindow = 8192
+
+// contextWindows are the context sizes of chat models, matched by the longest prefix
+var contextWindows = map[string]int{
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+	"gpt-4-turbo":   128000,
+	"gpt-4-32k":     32768,
+	"gpt-4":         8192,
+	"gpt-3.5-turbo": 16385,
+	"o1":            200000,
+	"o3":            200000,
+	"o4-mini":       200000,
+}
+
+// encodingResult is a cached encoding lookup, failures included so they are not retried for every text
+type encodingResult struct {
+	encoding *tiktoken.Tiktoken
+	err      error
+}
+
+var encodings sync.Map
+
+// The encodings ship with the binary, tiktoken would otherwise download them on first use
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// CountTokens returns the number of tokens of text for the model.
+// It estimates 4 characters per token when no encoding can be loaded.
+func CountTokens(text, model string) int {
+	encoding, err := encodingFor(model)
+	if err != nil {
+		return (len(text) + 3) / 4
+	}
+
+	return len(encoding.Encode(text, nil, nil))
+}
+
+// TruncateTokens cuts text down to at most limit tokens of the model
+func TruncateTokens(text, model string, limit int) string {
+	encoding, err := encodingFor(model)
+	if err != nil {
+		if len(text) > limit*4 {
+			return strings.ToValidUTF8(text[:limit*4], "")
+		}
+		return text
+	}
+
+	tokens := encoding.Encode(text, nil, nil)
+	if len(tokens) <= limit {
+		return text
+	}
+	return encoding.Decode(tokens[:limit])
+}
+
+// ContextWindow returns the number of tokens the model accepts, prompt and answer included
+func ContextWindow(model string) int {
+	window, longest := defaultContextWindow, 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			window, longest = size, len(prefix)
+		}
+	}
+	return window
+}
+
+func encodingFor(model string) (*tiktoken.Tiktoken, error) {
+	if cached, ok := encodings.Load(model); ok {
+		result := cached.(encodingResult)
+		return result.encoding, result.err
+	}
+
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		encoding, err = tiktoken.GetEncoding(fallbackEncoding)
+	}
+
+	encodings.Store(model, encodingResult{encoding: encoding, err: err})
+	return encoding, err
+}
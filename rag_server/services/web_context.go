@@ -0,0 +1,80 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"rag_server/cache"
+	"rag_server/models"
+	"sync"
+)
+
+const defaultWebResults = 3
+
+// WebContext searches the web for the query, crawls the top result pages
+// and returns their chunks most relevant to the query, marked as web sources
+func WebContext(clients *Clients, store cache.Cache, provider SearchProvider, query string, results, topK int) ([]models.ContextItem, error) {
+	links := SearchWebCached(store, provider, query, models.SearchOptions{}, clients.SearchTTL)
+	return CrawlContext(clients.Crawler, query, links, results, topK)
+}
+
+// CrawlContext crawls the first results links and returns their chunks most relevant to the query
+func CrawlContext(crawler *Crawler, query string, links []models.SearchResult, results, topK int) ([]models.ContextItem, error) {
+	if results <= 0 {
+		results = defaultWebResults
+	}
+
+	if len(links) == 0 {
+		return nil, nil
+	}
+	if len(links) > results {
+		links = links[:results]
+	}
+
+	// Pages are crawled concurrently into their own slot, so chunks stay ordered by link rank then
+	// position and equally scored chunks rank the same on every request
+	var wg sync.WaitGroup
+	pages := make([][]models.ContextItem, len(links))
+
+	for i, link := range links {
+		wg.Add(1)
+		go func(i int, link models.SearchResult) {
+			defer wg.Done()
+
+			page, err := crawler.RetrieveUrlContents(link.Url)
+			if err != nil {
+				log.Printf("Failed to crawl %s: %v", link.Url, err)
+				return
+			}
+
+			metadata, _ := json.Marshal(map[string]interface{}{
+				"url":          page.CanonicalURL,
+				"title":        firstNonEmpty(page.Title, link.Title),
+				"author":       page.Byline,
+				"published_at": page.PublishedAt,
+				"source":       "web",
+			})
+
+			chunks := SplitText(page.Markdown, defaultChunkSize, defaultChunkOverlap)
+
+			for j, chunk := range chunks {
+				pages[i] = append(pages[i], models.ContextItem{
+					ID:       fmt.Sprintf("%s#%d", link.Url, j),
+					Text:     chunk,
+					Metadata: metadata,
+					Origin:   "web",
+				})
+			}
+		}(i, link)
+	}
+
+	wg.Wait()
+
+	var items []models.ContextItem
+	for _, chunks := range pages {
+		items = append(items, chunks...)
+	}
+
+	// Web pages are not embedded, select the chunks by term overlap with the query
+	return (&LexicalReranker{}).Rerank(query, items, topK)
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"rag_server/models"
+	"time"
+)
+
+const (
+	defaultRefreshInterval = 24 * time.Hour
+
+	// refreshTick is how often the scheduler looks for documents due for a re-crawl
+	refreshTick      = time.Minute
+	refreshBatchSize = 20
+
+	// refreshRetryDelay is the delay after a first failed refresh, doubled by every following failure
+	refreshRetryDelay = 15 * time.Minute
+)
+
+// StartRefreshScheduler re-crawls web documents in the background once their refresh interval elapsed
+func StartRefreshScheduler(clients *Clients, db *sql.DB) {
+	go func() {
+		ticker := time.NewTicker(refreshTick)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := RefreshWebDocuments(clients, db, refreshBatchSize); err != nil {
+				log.Printf("Failed to refresh web documents: %v", err)
+			}
+		}
+	}()
+}
+
+// RefreshWebDocuments revalidates the documents due for a re-crawl with conditional requests,
+// re-embedding only those whose content changed and removing those that disappeared
+func RefreshWebDocuments(clients *Clients, db *sql.DB, limit int) error {
+	documents, err := dueWebDocuments(db, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		page, err := clients.Crawler.FetchHTMLIfModified(document.URL, document.ETag, document.LastModified)
+
+		var status *HTTPStatusError
+		switch {
+		case errors.As(err, &status) && (status.StatusCode == http.StatusNotFound || status.StatusCode == http.StatusGone):
+			if err := deleteWebDocument(db, document.URL); err != nil {
+				log.Printf("Failed to remove %s: %v", document.URL, err)
+			}
+			continue
+		case err != nil:
+			rescheduleWebDocument(db, document, err)
+			continue
+		}
+
+		if page.StatusCode == http.StatusNotModified {
+			document.ETag = firstNonEmpty(page.Header.Get("ETag"), document.ETag)
+			document.LastModified = firstNonEmpty(page.Header.Get("Last-Modified"), document.LastModified)
+			document.FetchedAt = time.Now()
+			document.NextFetchAt = document.FetchedAt.Add(document.RefreshInterval)
+			document.Failures = 0
+			if err := saveWebDocument(db, document); err != nil {
+				log.Printf("Failed to reschedule %s: %v", document.URL, err)
+			}
+			continue
+		}
+
+		article, err := ExtractArticle(page.Body, page.URL)
+		if err != nil {
+			rescheduleWebDocument(db, document, err)
+			continue
+		}
+		// Keep the document under the URL it was stored with
+		article.CanonicalURL = document.URL
+
+		if _, _, err := StoreWebPage(clients.Embedder, db, page, article, document.EmbeddingModel, document.RefreshInterval); err != nil {
+			rescheduleWebDocument(db, document, err)
+		}
+	}
+
+	return nil
+}
+
+// rescheduleWebDocument postpones the refresh of a document that failed, backing off
+// exponentially up to its refresh interval so it is not retried on every tick
+func rescheduleWebDocument(db *sql.DB, document models.WebDocument, cause error) {
+	log.Printf("Failed to refresh %s: %v", document.URL, cause)
+
+	delay := document.RefreshInterval
+	if document.Failures < 16 {
+		delay = min(refreshRetryDelay<<document.Failures, document.RefreshInterval)
+	}
+
+	document.Failures++
+	document.FetchedAt = time.Now()
+	document.NextFetchAt = document.FetchedAt.Add(delay)
+	if err := saveWebDocument(db, document); err != nil {
+		log.Printf("Failed to reschedule %s: %v", document.URL, err)
+	}
+}
+
+// StoreWebPage ingests a crawled page in the vector store, unless its content did not change
+// since it was last stored, and records its freshness. It reports whether the page was re-embedded.
+func StoreWebPage(embedder *Embedder, db *sql.DB, page *Page, article *models.WebPage, model string, interval time.Duration) (int, bool, error) {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	hash := sha256.Sum256([]byte(article.Markdown))
+	document := models.WebDocument{
+		URL:             article.CanonicalURL,
+		Title:           article.Title,
+		ETag:            page.Header.Get("ETag"),
+		LastModified:    page.Header.Get("Last-Modified"),
+		ContentHash:     hex.EncodeToString(hash[:]),
+		EmbeddingModel:  model,
+		RefreshInterval: interval,
+		FetchedAt:       time.Now(),
+	}
+	document.NextFetchAt = document.FetchedAt.Add(interval)
+
+	previous, err := loadWebDocument(db, document.URL)
+	if err != nil {
+		return 0, false, err
+	}
+
+	chunks := 0
+	changed := previous == nil || previous.ContentHash != document.ContentHash || previous.EmbeddingModel != model
+	if changed {
+		chunks, err = IngestDocument(embedder, db, article.Markdown, map[string]interface{}{
+			"document_id":  document.URL,
+			"url":          document.URL,
+			"title":        article.Title,
+			"author":       article.Byline,
+			"published_at": article.PublishedAt,
+			"content_hash": document.ContentHash,
+			"source":       "web",
+		}, model)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if err := saveWebDocument(db, document); err != nil {
+		return chunks, changed, err
+	}
+
+	return chunks, changed, nil
+}
+
+func loadWebDocument(db *sql.DB, url string) (*models.WebDocument, error) {
+	documents, err := queryWebDocuments(db, `WHERE url = $1`, url)
+	if err != nil || len(documents) == 0 {
+		return nil, err
+	}
+	return &documents[0], nil
+}
+
+func dueWebDocuments(db *sql.DB, limit int) ([]models.WebDocument, error) {
+	return queryWebDocuments(db, `WHERE next_fetch_at <= now() ORDER BY next_fetch_at LIMIT $1`, limit)
+}
+
+func queryWebDocuments(db *sql.DB, clause string, args ...interface{}) ([]models.WebDocument, error) {
+	rows, err := db.Query(`
+		SELECT url, title, etag, last_modified, content_hash, embedding_model,
+			EXTRACT(EPOCH FROM refresh_interval)::bigint, fetched_at, next_fetch_at, failures
+		FROM web_documents
+	`+clause+`;`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query web documents: %v", err)
+	}
+	defer rows.Close()
+
+	var documents []models.WebDocument
+	for rows.Next() {
+		var document models.WebDocument
+		var seconds int64
+		if err := rows.Scan(
+			&document.URL, &document.Title, &document.ETag, &document.LastModified, &document.ContentHash,
+			&document.EmbeddingModel, &seconds, &document.FetchedAt, &document.NextFetchAt, &document.Failures,
+		); err != nil {
+			return nil, fmt.Errorf("Failed to scan web document: %v", err)
+		}
+		document.RefreshInterval = time.Duration(seconds) * time.Second
+		documents = append(documents, document)
+	}
+
+	return documents, rows.Err()
+}
+
+func saveWebDocument(db *sql.DB, document models.WebDocument) error {
+	_, err := db.Exec(`
+		INSERT INTO web_documents (url, title, etag, last_modified, content_hash, embedding_model, refresh_interval, fetched_at, next_fetch_at, failures)
+		VALUES ($1, $2, $3, $4, $5, $6, $7 * interval '1 second', $8, $9, $10)
+		ON CONFLICT (url) DO UPDATE SET
+			title = EXCLUDED.title,
+			etag = EXCLUDED.etag,
+			last_modified = EXCLUDED.last_modified,
+			content_hash = EXCLUDED.content_hash,
+			embedding_model = EXCLUDED.embedding_model,
+			refresh_interval = EXCLUDED.refresh_interval,
+			fetched_at = EXCLUDED.fetched_at,
+			next_fetch_at = EXCLUDED.next_fetch_at,
+			failures = EXCLUDED.failures;
+	`,
+		document.URL, document.Title, document.ETag, document.LastModified, document.ContentHash,
+		document.EmbeddingModel, int64(document.RefreshInterval/time.Second), document.FetchedAt, document.NextFetchAt, document.Failures,
+	)
+	if err != nil {
+		return fmt.Errorf("Failed to save web document: %v", err)
+	}
+	return nil
+}
+
+// deleteWebDocument removes a page that disappeared along with its chunks
+func deleteWebDocument(db *sql.DB, url string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM n8n_vectors WHERE metadata->>'document_id' = $1;`, url); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM web_documents WHERE url = $1;`, url); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(invalidateAnswersQuery, url); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}